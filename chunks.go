@@ -0,0 +1,249 @@
+package main
+
+import (
+	"image"
+	"sort"
+
+	"github.com/hajimehoshi/ebiten/v2"
+
+	"weave/core"
+)
+
+// Chunks draws each layer a chunk of its tilemap at a time, so only the chunks in view are visited. When Cache is
+// set, each chunk of a flat layer is drawn once into an offscreen image and reused until it is edited, unless it has
+// animated tiles, which are drawn every frame.
+type Chunks struct {
+	Cache  bool
+	grid   core.Grid
+	images map[*core.Layer]map[image.Point]*ebiten.Image
+	// animations is whether each chunk of a layer has animated tiles, once it has been drawn
+	animations map[*core.Layer]map[image.Point]bool
+}
+
+func NewChunks() *Chunks {
+	return &Chunks{
+		Cache:      true,
+		images:     make(map[*core.Layer]map[image.Point]*ebiten.Image),
+		animations: make(map[*core.Layer]map[image.Point]bool),
+	}
+}
+
+// chunkOf is the chunk holding the cell at x, y
+func chunkOf(x, y int) image.Point {
+	return image.Pt(floorDiv(x, core.ChunkSize), floorDiv(y, core.ChunkSize))
+}
+
+// sync resets the chunks if the map has changed grids since they were drawn
+func (c *Chunks) sync(grid core.Grid) {
+	if grid != c.grid {
+		c.Reset()
+		c.grid = grid
+	}
+}
+
+// Invalidate drops the cached images of the chunks covering the cells of rect in every layer
+func (c *Chunks) Invalidate(rect image.Rectangle) {
+	if rect.Empty() {
+		return
+	}
+	min, max := chunkOf(rect.Min.X, rect.Min.Y), chunkOf(rect.Max.X-1, rect.Max.Y-1)
+	for _, images := range c.images {
+		for cx := min.X; cx <= max.X; cx++ {
+			for cy := min.Y; cy <= max.Y; cy++ {
+				p := image.Pt(cx, cy)
+				if img := images[p]; img != nil {
+					img.Dispose()
+					delete(images, p)
+				}
+			}
+		}
+	}
+	for _, animations := range c.animations {
+		for cx := min.X; cx <= max.X; cx++ {
+			for cy := min.Y; cy <= max.Y; cy++ {
+				delete(animations, image.Pt(cx, cy))
+			}
+		}
+	}
+}
+
+// Reset drops every cached image, e.g. after an edit that could have touched any cell
+func (c *Chunks) Reset() {
+	for _, images := range c.images {
+		for _, img := range images {
+			img.Dispose()
+		}
+	}
+	c.images = make(map[*core.Layer]map[image.Point]*ebiten.Image)
+	c.animations = make(map[*core.Layer]map[image.Point]bool)
+}
+
+// animated is true if the chunk of l has animated tiles, so it can't be cached
+func (c *Chunks) animated(m *Map, l *core.Layer, chunk image.Point) bool {
+	if animated, ok := c.animations[l][chunk]; ok {
+		return animated
+	}
+	animated := false
+	rect := core.ChunkRect(chunk)
+	for y := rect.Min.Y; y < rect.Max.Y && !animated; y++ {
+		for x := rect.Min.X; x < rect.Max.X && !animated; x++ {
+			for _, tile := range l.Tilemap.Get(x, y) {
+				if m.Animation(tile) != nil {
+					animated = true
+				}
+			}
+		}
+	}
+	if c.animations[l] == nil {
+		c.animations[l] = make(map[image.Point]bool)
+	}
+	c.animations[l][chunk] = animated
+	return animated
+}
+
+// Visible lists the chunks of l with tiles among cells, in rows from the top down
+func (c *Chunks) Visible(l *core.Layer, cells image.Rectangle) []image.Point {
+	min, max := chunkOf(cells.Min.X, cells.Min.Y), chunkOf(cells.Max.X-1, cells.Max.Y-1)
+	var visible []image.Point
+	if (max.X-min.X+1)*(max.Y-min.Y+1) > len(l.Tilemap) {
+		// zoomed far out, there are fewer chunks with tiles than in view
+		for _, p := range l.Tilemap.Chunks() {
+			if p.X >= min.X && p.X <= max.X && p.Y >= min.Y && p.Y <= max.Y {
+				visible = append(visible, p)
+			}
+		}
+		return visible
+	}
+	for cy := min.Y; cy <= max.Y; cy++ {
+		for cx := min.X; cx <= max.X; cx++ {
+			if l.Tilemap.Occupied(image.Pt(cx, cy)) {
+				visible = append(visible, image.Pt(cx, cy))
+			}
+		}
+	}
+	return visible
+}
+
+// image returns the cached image of a chunk of a flat layer, drawing it if it was edited, along with where its top
+// left corner is relative to the position of the chunk's first cell. The image covers whatever tiles larger than a
+// cell overdraw past the chunk's edges. It returns nil for empty chunks.
+func (c *Chunks) image(m *Map, l *core.Layer, chunk image.Point) (*ebiten.Image, image.Point) {
+	rect := core.ChunkRect(chunk)
+	bounds := m.Grid.Bounds(rect, m.TileWidth, m.TileHeight)
+	overdraw := m.Overdraw(m.TileWidth, m.TileHeight)
+	bounds = image.Rectangle{Min: bounds.Min.Add(overdraw.Min), Max: bounds.Max.Add(overdraw.Max)}
+	if img := c.images[l][chunk]; img != nil {
+		return img, bounds.Min
+	}
+	if !l.Tilemap.Occupied(chunk) {
+		return nil, bounds.Min
+	}
+	img := ebiten.NewImage(bounds.Dx(), bounds.Dy())
+	var geom ebiten.GeoM
+	geom.Translate(m.Grid.Position(rect.Min.X, rect.Min.Y, float64(m.TileWidth), float64(m.TileHeight)))
+	geom.Invert()
+	geom.Translate(-float64(bounds.Min.X), -float64(bounds.Min.Y))
+	m.drawCells(img, l, rect, geom, 1)
+	if c.images[l] == nil {
+		c.images[l] = make(map[image.Point]*ebiten.Image)
+	}
+	c.images[l][chunk] = img
+	return img, bounds.Min
+}
+
+// batch is the triangles of every tile drawn from one spritesheet at once
+type batch struct {
+	vertices []ebiten.Vertex
+	indices  []uint16
+}
+
+func (b *batch) add(src image.Rectangle, geom ebiten.GeoM) {
+	i := uint16(len(b.vertices))
+	w, h := float64(src.Dx()), float64(src.Dy())
+	for _, corner := range [][2]float64{{0, 0}, {w, 0}, {0, h}, {w, h}} {
+		x, y := geom.Apply(corner[0], corner[1])
+		b.vertices = append(b.vertices, ebiten.Vertex{
+			DstX:   float32(x),
+			DstY:   float32(y),
+			SrcX:   float32(float64(src.Min.X) + corner[0]),
+			SrcY:   float32(float64(src.Min.Y) + corner[1]),
+			ColorR: 1,
+			ColorG: 1,
+			ColorB: 1,
+			ColorA: 1,
+		})
+	}
+	b.indices = append(b.indices, i, i+1, i+2, i+1, i+3, i+2)
+}
+
+// drawCells draws the tiles of l within rect lying flat, with geom placing top down pixels on dst. The stacks are
+// drawn a level at a time, each level as a single batch of triangles per spritesheet. Tiles larger than a cell are
+// drawn after every level, row by row from the top down so those further down overdraw those behind them.
+func (m *Map) drawCells(dst *ebiten.Image, l *core.Layer, rect image.Rectangle, geom ebiten.GeoM, opacity float64) {
+	w, h := float64(m.TileWidth), float64(m.TileHeight)
+	now := animationTime()
+	var levels []map[string]*batch
+	// oversized are the batches of consecutive oversized tiles from the same spritesheet, in the order they're drawn
+	var oversized []*batch
+	var oversizedSheets []string
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			for z, tile := range l.Tilemap.Get(x, y) {
+				tile = m.Frame(tile, now)
+				sheet := m.Spritesheets[tile.Spritesheet]
+				if sheet == nil || tile.Index < 0 || tile.Index >= sheet.Len() {
+					continue
+				}
+				var b *batch
+				if m.Oversized(tile, m.TileWidth, m.TileHeight) {
+					if n := len(oversized); n == 0 || oversizedSheets[n-1] != tile.Spritesheet {
+						oversized = append(oversized, new(batch))
+						oversizedSheets = append(oversizedSheets, tile.Spritesheet)
+					}
+					b = oversized[len(oversized)-1]
+				} else {
+					for len(levels) <= z {
+						levels = append(levels, make(map[string]*batch))
+					}
+					b = levels[z][tile.Spritesheet]
+					if b == nil {
+						b = new(batch)
+						levels[z][tile.Spritesheet] = b
+					}
+				}
+				src := *sheet.Rect(tile.Index)
+				op := new(ebiten.DrawImageOptions)
+				flipGeoM(op, tile.Flip, float64(src.Dx()), float64(src.Dy()))
+				anchor := m.Anchor(tile, m.TileWidth, m.TileHeight)
+				op.GeoM.Translate(float64(anchor.X), float64(anchor.Y))
+				op.GeoM.Translate(m.Grid.Position(x, y, w, h))
+				op.GeoM.Concat(geom)
+				b.add(src, op.GeoM)
+			}
+		}
+	}
+	for _, batches := range levels {
+		names := make([]string, 0, len(batches))
+		for name := range batches {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			m.drawBatch(dst, batches[name], name, opacity)
+		}
+	}
+	for i, b := range oversized {
+		m.drawBatch(dst, b, oversizedSheets[i], opacity)
+	}
+}
+
+// drawBatch draws the triangles of b from the named spritesheet
+func (m *Map) drawBatch(dst *ebiten.Image, b *batch, sheet string, opacity float64) {
+	img := m.Textures.Sheet(sheet)
+	if img == nil {
+		return
+	}
+	op := new(ebiten.DrawTrianglesOptions)
+	op.ColorM.Scale(1, 1, 1, opacity)
+	dst.DrawTriangles(b.vertices, b.indices, img, op)
+}
@@ -0,0 +1,206 @@
+// weave-generate runs a generator over a sample map without opening a window, see the README for its usage
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"weave/core"
+)
+
+type options core.Options
+
+func (o options) String() string {
+	return fmt.Sprint(core.Options(o))
+}
+
+func (o options) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	o[name] = v
+	return nil
+}
+
+type rect image.Rectangle
+
+func (r *rect) String() string {
+	return image.Rectangle(*r).String()
+}
+
+func (r *rect) Set(s string) error {
+	var x0, y0, x1, y1 int
+	if _, err := fmt.Sscanf(s, "%d,%d,%d,%d", &x0, &y0, &x1, &y1); err != nil {
+		return fmt.Errorf("expected x0,y0,x1,y1, got %q", s)
+	}
+	*r = rect(image.Rect(x0, y0, x1, y1))
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	var (
+		in        = flag.String("in", "map.json", "comma separated sample maps to learn from, the first also supplies the tileset and layers")
+		out       = flag.String("out", "", "file to write, .png renders the result, .tmx or .tmj writes a Tiled map, anything else writes map JSON")
+		ruleset   = flag.String("ruleset", "", "ruleset file to follow instead of learning from the samples")
+		learn     = flag.String("learn", "", "ruleset file to write the rules learned from the samples to")
+		algorithm = flag.String("algorithm", "wfc", "one of "+strings.Join(core.AlgorithmNames(), ", "))
+		width     = flag.Int("width", 32, "width of the generated map in tiles")
+		height    = flag.Int("height", 32, "height of the generated map in tiles")
+		seed      = flag.Int64("seed", 0, "random seed")
+		layers    = flag.String("layers", "", "comma separated layers of the sample to learn from and generate, all layers if empty")
+		constrain = flag.String("constraints", "", "JSON file of constraints to follow instead of the first sample's")
+		opts      = make(options)
+		fixed     rect
+	)
+	flag.Var(opts, "opt", "algorithm parameter as name=value, may be repeated")
+	flag.Var(&fixed, "fixed", "region x0,y0,x1,y1 of the sample to copy into the output and keep fixed")
+	flag.Parse()
+	if *out == "" && *learn == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var samples []*core.Map
+	for _, filename := range strings.Split(*in, ",") {
+		sample, err := load(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		samples = append(samples, sample)
+	}
+	sample := samples[0]
+	var names []string
+	if *layers != "" {
+		names = strings.Split(*layers, ",")
+		for i, s := range samples {
+			for _, name := range names {
+				if s.Layer(name) == nil {
+					log.Fatalf("%s: no layer %q", strings.Split(*in, ",")[i], name)
+				}
+			}
+		}
+	}
+	a, err := core.LookupAlgorithm(*algorithm)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *ruleset != "" {
+		if sample.Ruleset, err = core.LoadAnalysis(*ruleset); err != nil {
+			log.Fatal(err)
+		}
+	} else if len(samples) > 1 || *learn != "" {
+		var analyses []*core.Analysis
+		for _, s := range samples {
+			analysis, err := a.Analysis(s.Combine(names), sample.Grid, s.Tileset, core.Options(opts))
+			if err != nil {
+				log.Fatal(err)
+			}
+			analyses = append(analyses, analysis)
+		}
+		sample.Ruleset = analyses[0].Merge(analyses[1:]...)
+	}
+	if *learn != "" {
+		if err := sample.Ruleset.Save(*learn); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *out == "" {
+		return
+	}
+	if *constrain != "" {
+		buf, err := os.ReadFile(*constrain)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := json.Unmarshal(buf, &sample.Constraints); err != nil {
+			log.Fatalf("%s: %v", *constrain, err)
+		}
+	}
+	gen, err := sample.NewGeneration(
+		names,
+		image.Rectangle(fixed),
+		image.Rect(0, 0, *width, *height),
+		*algorithm,
+		core.Options(opts),
+		*seed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for !gen.Step(1) {
+	}
+	result := core.NewMap(sample.TileWidth, sample.TileHeight, sample.Tileset)
+	result.Grid = sample.Grid
+	if sample.Manifest != "" {
+		// draw from the sample's manifest, which is relative to the sample
+		dir := filepath.Dir(strings.Split(*in, ",")[0])
+		if err := result.UseManifest(filepath.Join(dir, filepath.FromSlash(sample.Manifest))); err != nil {
+			log.Fatal(err)
+		}
+	}
+	result.Layers = nil
+	for _, name := range gen.Layers {
+		l := *sample.Layer(name)
+		l.Tilemap, l.Locked = make(core.Tilemap), false
+		result.Layers = append(result.Layers, &l)
+	}
+	if err := gen.Apply(result, nil); err != nil {
+		log.Fatal(err)
+	}
+
+	switch strings.ToLower(filepath.Ext(*out)) {
+	case ".png":
+		err = render(result, *width, *height, *out)
+	case ".tmx", ".tmj":
+		err = core.ExportTiled(result, *out)
+	default:
+		err = result.Save(*out)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func load(filename string) (*core.Map, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".tmx", ".tmj":
+		return core.ImportTiled(filename)
+	}
+	m := core.NewMap(0, 0, core.NewTileset())
+	if err := m.Load(filename); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return m, nil
+}
+
+func render(m *core.Map, width, height int, filename string) error {
+	if err := m.Tileset.Load(); err != nil {
+		return err
+	}
+	img := m.Render(image.Rect(0, 0, width, height))
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,223 @@
+package core
+
+import (
+	"image"
+	"math/rand"
+)
+
+// Direction is a compass direction from one cell to its neighbor, each Grid uses some of them
+type Direction int
+
+const (
+	North = Direction(0)
+	South = Direction(1)
+	West  = Direction(2)
+	East  = Direction(3)
+	// the diagonals are neighbors in square-8 and hexagonal grids
+	NorthWest = Direction(4)
+	SouthEast = Direction(5)
+	NorthEast = Direction(6)
+	SouthWest = Direction(7)
+)
+
+// NumDirections is the number of Directions, and the size of the second dimension of Analysis.Adj
+const NumDirections = 8
+
+var directionNames = []string{"north", "south", "west", "east", "northwest", "southeast", "northeast", "southwest"}
+
+func (d Direction) String() string {
+	if d >= 0 && int(d) < len(directionNames) {
+		return directionNames[d]
+	}
+	return "unknown"
+}
+
+func (d Direction) Inverse() Direction {
+	if d%2 == 0 {
+		return d + 1
+	}
+	return d - 1
+}
+
+// Neighbors are the offsets of each Direction on a square grid
+var Neighbors = [NumDirections][2]int{
+	{0, -1},  // North
+	{0, 1},   // South
+	{-1, 0},  // West
+	{1, 0},   // East
+	{-1, -1}, // NorthWest
+	{1, 1},   // SouthEast
+	{1, -1},  // NorthEast
+	{-1, 1},  // SouthWest
+}
+
+type Analysis struct {
+	// Grid is the topology the adjacencies were learned on, only its directions have any
+	Grid          Grid
+	Domain        []Stack
+	DomainIndex   map[string]int
+	Probabilities []float64
+	Adj           *NDArray[map[int]bool] // Domain, NumDirections
+	// Footprints are the cells covered by each level of each entry, relative to its cell, nil if every tile fits its
+	// cell, see Analysis.Footprint
+	Footprints [][]image.Rectangle
+}
+
+func Analyze(tilemap Tilemap, grid Grid) *Analysis {
+	domainIndex := map[string]int{
+		"": 0,
+	}
+	tilemap.Each(func(x, y int, tiles Stack) {
+		if h := tiles.Hash(); domainIndex[h] == 0 {
+			domainIndex[h] = len(domainIndex)
+		}
+	})
+	probs := make([]float64, len(domainIndex))
+	adj := NewNDArray[map[int]bool](len(domainIndex), NumDirections)
+	domain := make([]Stack, len(domainIndex))
+	tilemap.Each(func(x, y int, tiles Stack) {
+		i := domainIndex[tiles.Hash()]
+		domain[i] = tiles
+		probs[i]++
+		for _, d := range grid.Directions() {
+			nx, ny := grid.Neighbor(x, y, d)
+			n := domainIndex[tilemap.Get(nx, ny).Hash()]
+			a := adj.At(i, int(d))
+			if a == nil {
+				a = make(map[int]bool)
+				adj.Set(a, i, int(d))
+			}
+			a[n] = true
+			di := int(d.Inverse())
+			a = adj.At(n, di)
+			if a == nil {
+				a = make(map[int]bool)
+				adj.Set(a, n, di)
+			}
+			a[i] = true
+		}
+	})
+	var sum float64
+	for _, count := range probs {
+		sum += count
+	}
+	for i, count := range probs {
+		probs[i] = count / sum
+	}
+	return &Analysis{
+		Grid:          grid,
+		Domain:        domain,
+		DomainIndex:   domainIndex,
+		Probabilities: probs,
+		Adj:           adj,
+	}
+}
+
+func (a *Analysis) Lottery(rng *rand.Rand, allowed func(i int) bool) int {
+	var ticketCount float64
+	tickets := make(map[int]float64)
+	for i := range a.Domain {
+		if !allowed(i) {
+			continue
+		}
+		tickets[i] = a.Probabilities[i]
+		ticketCount += a.Probabilities[i]
+	}
+	if ticketCount == 0 {
+		// only entries that are never likely fit, e.g. tiles weighed 0, so any of them will do
+		for i := range tickets {
+			tickets[i] = 1
+		}
+		ticketCount = float64(len(tickets))
+	}
+	ticket := rng.Float64() * ticketCount
+	winner := -1
+	for i := 0; i < len(a.Domain); i++ {
+		ticket -= tickets[i]
+		if winner == -1 && ticket <= 0 {
+			winner = i
+		}
+	}
+	return winner
+}
+
+// Expand adds every rotation and reflection of the domain allowed by the symmetry classes of its tiles, along
+// with the adjacencies the transformed sample would have had, so a wall running north to south in the sample
+// also teaches walls running east to west. Probabilities are shared evenly between the variants of each entry.
+// Stacks containing tiles without a symmetry class are kept as they are. Tiles can't be rotated to fit a
+// hexagonal grid, so analyses of one are returned unchanged.
+func (a *Analysis) Expand(sym SymmetryLookup) *Analysis {
+	if a.Grid.Hexagonal() {
+		return a
+	}
+	domainIndex := map[string]int{
+		"": 0,
+	}
+	domain := []Stack{nil}
+	// variants[t][i] is the index of domain entry i transformed by Transforms[t], or -1 if it can't be
+	var variants [len(Transforms)][]int
+	for t, f := range Transforms {
+		variants[t] = make([]int, len(a.Domain))
+		for i, stack := range a.Domain {
+			variants[t][i] = -1
+			s, ok := transformStack(stack, f, sym)
+			if !ok {
+				continue
+			}
+			h := s.Hash()
+			j, ok := domainIndex[h]
+			if !ok {
+				j = len(domain)
+				domainIndex[h] = j
+				domain = append(domain, s)
+			}
+			variants[t][i] = j
+		}
+	}
+	weights := make([]float64, len(domain))
+	adj := NewNDArray[map[int]bool](len(domain), NumDirections)
+	for i := range a.Domain {
+		var n float64
+		for t := range Transforms {
+			if variants[t][i] >= 0 {
+				n++
+			}
+		}
+		for t, f := range Transforms {
+			vi := variants[t][i]
+			if vi < 0 {
+				continue
+			}
+			weights[vi] += a.Probabilities[i] / n
+			for _, d := range a.Grid.Directions() {
+				for k := range a.Adj.At(i, int(d)) {
+					vk := variants[t][k]
+					if vk < 0 {
+						continue
+					}
+					td := f.Direction(d)
+					s := adj.At(vi, int(td))
+					if s == nil {
+						s = make(map[int]bool)
+						adj.Set(s, vi, int(td))
+					}
+					s[vk] = true
+				}
+			}
+		}
+	}
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	for i := range weights {
+		weights[i] /= sum
+	}
+	return &Analysis{
+		Grid:          a.Grid,
+		Domain:        domain,
+		DomainIndex:   domainIndex,
+		Probabilities: weights,
+		Adj:           adj,
+	}
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+An animated tile cycles through other tiles of its spritesheet, each shown for a while, e.g. water, torches or lava.
+Only the animated tile is placed on the map and its frames are a matter of drawing it, so stacks, and the rules learned
+from them, hold a single tile however many frames it has. A frame placed on its own is learned as the animated tile,
+see Tileset.Unanimate. Animations belong to the spritesheet, so are saved with it in the map or its manifest.
+*/
+
+// DefaultFrameDuration is how long a frame is shown when ParseAnimation isn't told, in milliseconds
+const DefaultFrameDuration = 100
+
+// Frame shows the tile at Index of the spritesheet for Duration milliseconds
+type Frame struct {
+	Index    int
+	Duration int
+}
+
+// Animation is the frames of an animated tile, shown in order over and over
+type Animation []Frame
+
+// Duration is how long the animation takes to play once, in milliseconds
+func (a Animation) Duration() int {
+	var d int
+	for _, f := range a {
+		d += max(f.Duration, 0)
+	}
+	return d
+}
+
+// At is the index of the tile shown ms milliseconds into playing the animation, or -1 if it has no frames
+func (a Animation) At(ms int64) int {
+	if len(a) == 0 {
+		return -1
+	}
+	d := int64(a.Duration())
+	if d == 0 {
+		return a[0].Index
+	}
+	t := int(ms % d)
+	if t < 0 {
+		t += int(d)
+	}
+	for _, f := range a {
+		if t < f.Duration {
+			return f.Index
+		}
+		t -= max(f.Duration, 0)
+	}
+	return a[len(a)-1].Index
+}
+
+// String writes a as its frames separated by spaces, each an index and a duration, e.g. "4:150 5:150"
+func (a Animation) String() string {
+	frames := make([]string, len(a))
+	for i, f := range a {
+		frames[i] = fmt.Sprintf("%d:%d", f.Index, f.Duration)
+	}
+	return strings.Join(frames, " ")
+}
+
+// ParseAnimation reads an animation written by Animation.String, frames written as an index alone being shown for
+// DefaultFrameDuration
+func ParseAnimation(s string) (Animation, error) {
+	var a Animation
+	for _, field := range strings.Fields(s) {
+		index, duration, timed := strings.Cut(field, ":")
+		f := Frame{Duration: DefaultFrameDuration}
+		var err error
+		if f.Index, err = strconv.Atoi(index); err != nil || f.Index < 0 {
+			return nil, fmt.Errorf("frame %q: bad index", field)
+		}
+		if timed {
+			if f.Duration, err = strconv.Atoi(duration); err != nil || f.Duration <= 0 {
+				return nil, fmt.Errorf("frame %q: bad duration", field)
+			}
+		}
+		a = append(a, f)
+	}
+	return a, nil
+}
+
+// Animation is the animation of the tile at index, nil if it isn't animated
+func (s *Spritesheet) Animation(index int) Animation {
+	if s == nil {
+		return nil
+	}
+	return s.Animations[index]
+}
+
+// SetAnimation animates the tile at index, or stops animating it if a has no frames
+func (s *Spritesheet) SetAnimation(index int, a Animation) {
+	if len(a) == 0 {
+		delete(s.Animations, index)
+		return
+	}
+	if s.Animations == nil {
+		s.Animations = make(map[int]Animation)
+	}
+	s.Animations[index] = a
+}
+
+// Animated is the animated tile whose frames include the tile at index, the lowest if there are several, or index
+// itself if it's animated or isn't a frame
+func (s *Spritesheet) Animated(index int) int {
+	if s == nil || s.Animations[index] != nil {
+		return index
+	}
+	animated := make([]int, 0, len(s.Animations))
+	for i := range s.Animations {
+		animated = append(animated, i)
+	}
+	sort.Ints(animated)
+	for _, i := range animated {
+		for _, f := range s.Animations[i] {
+			if f.Index == index {
+				return i
+			}
+		}
+	}
+	return index
+}
+
+// Animation is the animation of t, nil if it isn't animated
+func (ts *Tileset) Animation(t *Tile) Animation {
+	if ts == nil || t == nil {
+		return nil
+	}
+	return ts.Spritesheets[t.Spritesheet].Animation(t.Index)
+}
+
+// Frame is the tile drawn in place of t ms milliseconds into playing its animation, t itself if it isn't animated
+func (ts *Tileset) Frame(t *Tile, ms int64) *Tile {
+	a := ts.Animation(t)
+	if a == nil {
+		return t
+	}
+	return &Tile{Spritesheet: t.Spritesheet, Index: a.At(ms), Flip: t.Flip}
+}
+
+// Unanimate returns tilemap with every frame of an animation replaced by the animated tile, or tilemap itself if it
+// has none
+func (ts *Tileset) Unanimate(tilemap Tilemap) Tilemap {
+	animated := false
+	for _, sheet := range ts.Spritesheets {
+		if len(sheet.Animations) > 0 {
+			animated = true
+		}
+	}
+	if !animated {
+		return tilemap
+	}
+	unanimated := make(Tilemap)
+	tilemap.Each(func(x, y int, tiles Stack) {
+		stack := tiles.Clone()
+		for z, t := range stack {
+			if t == nil {
+				continue
+			}
+			if i := ts.Spritesheets[t.Spritesheet].Animated(t.Index); i != t.Index {
+				stack[z] = &Tile{Spritesheet: t.Spritesheet, Index: i, Flip: t.Flip}
+			}
+		}
+		unanimated.Put(stack, x, y)
+	})
+	return unanimated
+}
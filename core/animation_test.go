@@ -0,0 +1,68 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnimation(t *testing.T) {
+	a := Animation{{Index: 4, Duration: 100}, {Index: 5, Duration: 100}, {Index: 6, Duration: 200}}
+	for ms, want := range map[int64]int{0: 4, 99: 4, 100: 5, 250: 6, 399: 6, 400: 4, 1320: 5, -1: 6} {
+		if got := a.At(ms); got != want {
+			t.Fatalf("wrong frame at %dms, got %d, want %d", ms, got, want)
+		}
+	}
+	if got := Animation(nil).At(10); got != -1 {
+		t.Fatalf("expected no frame without frames, got %d", got)
+	}
+	parsed, err := ParseAnimation(a.String())
+	if err != nil || !reflect.DeepEqual(parsed, a) {
+		t.Fatalf("wrong animation from %q, got %v, %v", a.String(), parsed, err)
+	}
+	if parsed, err := ParseAnimation(" 1  2:50 "); err != nil || !reflect.DeepEqual(parsed, Animation{{1, DefaultFrameDuration}, {2, 50}}) {
+		t.Fatalf("wrong animation, got %v, %v", parsed, err)
+	}
+	for _, s := range []string{"a", "1:0", "-1:10", "1:x"} {
+		if _, err := ParseAnimation(s); err == nil {
+			t.Fatalf("expected %q not to parse", s)
+		}
+	}
+}
+
+func TestAnimatedDomain(t *testing.T) {
+	ts := NewTileset()
+	ts.Spritesheets["a"] = &Spritesheet{Name: "a", TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	water := Animation{{Index: 4, Duration: 100}, {Index: 5, Duration: 100}, {Index: 6, Duration: 100}}
+	ts.Spritesheets["a"].SetAnimation(4, water)
+	if got := ts.Frame(&Tile{Spritesheet: "a", Index: 4, Flip: FlipHorizontal}, 150); *got != (Tile{Spritesheet: "a", Index: 5, Flip: FlipHorizontal}) {
+		t.Fatalf("wrong frame %+v", got)
+	}
+	if got := ts.Frame(&Tile{Spritesheet: "a", Index: 1}, 150); got.Index != 1 {
+		t.Fatalf("expected a still tile to stay put, got %+v", got)
+	}
+	// water painted with its frames as well as the animated tile
+	sample := make(Tilemap)
+	for y, row := range []string{"0456", "0440", "6500"} {
+		for x, c := range row {
+			sample.Put(Stack{{Spritesheet: "a", Index: int(c - '0')}}, x, y)
+		}
+	}
+	a, err := LookupAlgorithm("wfc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysis, err := a.Analysis(sample, GridSquare, ts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var domain []string
+	for _, stack := range analysis.Domain[1:] {
+		domain = append(domain, stack.Hash())
+	}
+	if want := []string{"a:0", "a:4"}; !reflect.DeepEqual(domain, want) {
+		t.Fatalf("wrong domain, got %v, want %v", domain, want)
+	}
+	if sample.Get(2, 0).Hash() != "a:5" {
+		t.Fatal("expected the sample to be left alone")
+	}
+}
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+)
+
+// ConstraintKind is what a Constraint requires of the cells of its region
+type ConstraintKind uint8
+
+const (
+	// ConstraintCount bounds how many cells hold one of the tiles, e.g. at most three treasure chests
+	ConstraintCount = ConstraintKind(iota)
+	// ConstraintConnected joins every point by a path through cells holding the tiles, e.g. floor from the
+	// entrance to the exit
+	ConstraintConnected
+	// ConstraintBorder only allows the tiles along the edge of the region, e.g. walls around a room
+	ConstraintBorder
+)
+
+var constraintKindNames = []string{"count", "connected", "border"}
+
+func (k ConstraintKind) String() string {
+	if int(k) < len(constraintKindNames) {
+		return constraintKindNames[k]
+	}
+	return fmt.Sprintf("ConstraintKind(%d)", k)
+}
+
+func (k ConstraintKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *ConstraintKind) UnmarshalText(text []byte) error {
+	for i, name := range constraintKindNames {
+		if string(text) == name {
+			*k = ConstraintKind(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown constraint %q", text)
+}
+
+/*
+Constraint is a rule over a whole region of a generation, where the rules of an Analysis only relate neighbors.
+Constraints are attached to a generation with Generation.Constrain, and those of a map to each of its generations
+whose region holds them, see Map.NewGeneration.
+*/
+type Constraint struct {
+	Kind ConstraintKind
+	// Tiles are the tiles the constraint is about, as "spritesheet:index" or "#tag" for every tile of the tileset
+	// with that tag, a cell matches if its stack holds any of them whichever way they're flipped
+	Tiles []string
+	// Region is the cells of the map the constraint applies to, the whole region being generated if it's empty
+	Region image.Rectangle `json:",omitempty"`
+	// Min and Max bound a count, a nil Max is no limit
+	Min int  `json:",omitempty"`
+	Max *int `json:",omitempty"`
+	// Points are the cells of the map to connect
+	Points []image.Point `json:",omitempty"`
+}
+
+// over is true if a count of n is more than Max
+func (c *Constraint) over(n int) bool {
+	return c.Max != nil && n > *c.Max
+}
+
+// Matches is true if stack holds one of the constraint's tiles
+func (c *Constraint) Matches(stack Stack) bool {
+	for _, t := range stack {
+		if t == nil {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", t.Spritesheet, t.Index)
+		for _, k := range c.Tiles {
+			if k == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tagged returns the constraint with each "#tag" of its tiles replaced by the tiles of tileset with that tag
+func (c Constraint) tagged(tileset *Tileset) Constraint {
+	var tiles []string
+	for _, k := range c.Tiles {
+		if !strings.HasPrefix(k, "#") {
+			tiles = append(tiles, k)
+			continue
+		}
+		if tileset == nil {
+			continue
+		}
+		for name, sheet := range tileset.Spritesheets {
+			for i, p := range sheet.Properties {
+				if p.HasTag(k[1:]) {
+					tiles = append(tiles, fmt.Sprintf("%s:%d", name, i))
+				}
+			}
+		}
+	}
+	sort.Strings(tiles)
+	c.Tiles = tiles
+	return c
+}
+
+// within returns the constraint relative to rect, with its region filled in, or false if it doesn't lie within
+// rect
+func (c Constraint) within(rect image.Rectangle) (Constraint, bool) {
+	if c.Region.Empty() {
+		c.Region = rect
+	}
+	if !c.Region.In(rect) {
+		return c, false
+	}
+	c.Region = c.Region.Sub(rect.Min)
+	points := make([]image.Point, len(c.Points))
+	for i, p := range c.Points {
+		points[i] = p.Sub(rect.Min)
+	}
+	c.Points = points
+	return c, true
+}
+
+// Check returns why result breaks the constraint, or nil if it doesn't, with the cells of the constraint relative to
+// result. Paths follow the neighbors of grid.
+func (c *Constraint) Check(result [][]Stack, grid Grid) error {
+	at := func(x, y int) Stack {
+		if x < 0 || x >= len(result) || y < 0 || y >= len(result[x]) {
+			return nil
+		}
+		return result[x][y]
+	}
+	r := c.Region
+	switch c.Kind {
+	case ConstraintCount:
+		n := 0
+		for x := r.Min.X; x < r.Max.X; x++ {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				if c.Matches(at(x, y)) {
+					n++
+				}
+			}
+		}
+		if n < c.Min || c.over(n) {
+			return fmt.Errorf("%d cells of %v have %v", n, r, c.Tiles)
+		}
+	case ConstraintConnected:
+		if len(c.Points) == 0 {
+			return nil
+		}
+		start := c.Points[0]
+		if !start.In(r) || !c.Matches(at(start.X, start.Y)) {
+			return fmt.Errorf("%v doesn't have %v", start, c.Tiles)
+		}
+		reached := map[image.Point]bool{start: true}
+		queue := []image.Point{start}
+		for len(queue) > 0 {
+			p := queue[0]
+			queue = queue[1:]
+			for _, d := range grid.Directions() {
+				nx, ny := grid.Neighbor(p.X, p.Y, d)
+				n := image.Pt(nx, ny)
+				if !reached[n] && n.In(r) && c.Matches(at(nx, ny)) {
+					reached[n] = true
+					queue = append(queue, n)
+				}
+			}
+		}
+		for _, p := range c.Points[1:] {
+			if !reached[p] {
+				return fmt.Errorf("no path of %v from %v to %v", c.Tiles, start, p)
+			}
+		}
+	case ConstraintBorder:
+		for x := r.Min.X; x < r.Max.X; x++ {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				if onBorder(r, x, y) && !c.Matches(at(x, y)) {
+					return fmt.Errorf("%d, %d on the border of %v doesn't have %v", x, y, r, c.Tiles)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// onBorder is true if x, y is one of the outermost cells of r
+func onBorder(r image.Rectangle, x, y int) bool {
+	return x == r.Min.X || y == r.Min.Y || x == r.Max.X-1 || y == r.Max.Y-1
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"encoding/json"
+	"image"
+	"testing"
+)
+
+func atMost(n int) *int {
+	return &n
+}
+
+func TestConstraintCheck(t *testing.T) {
+	var result [][]Stack
+	for x, col := range []string{"1111", "1021", "1001", "1111"} {
+		result = append(result, nil)
+		for _, c := range col {
+			result[x] = append(result[x], Stack{{Spritesheet: "a", Index: int(c - '0')}})
+		}
+	}
+	for _, test := range []struct {
+		c  Constraint
+		ok bool
+	}{
+		{Constraint{Kind: ConstraintCount, Tiles: []string{"a:2"}, Min: 1, Max: atMost(1)}, true},
+		{Constraint{Kind: ConstraintCount, Tiles: []string{"a:2"}, Min: 2}, false},
+		{Constraint{Kind: ConstraintCount, Tiles: []string{"a:0", "a:2"}, Max: atMost(2)}, false},
+		{Constraint{Kind: ConstraintConnected, Tiles: []string{"a:0"}, Points: []image.Point{{1, 1}, {2, 2}}}, true},
+		{Constraint{Kind: ConstraintConnected, Tiles: []string{"a:0"}, Points: []image.Point{{1, 1}, {1, 2}}}, false},
+		{Constraint{Kind: ConstraintConnected, Tiles: []string{"a:0"}, Region: image.Rect(1, 1, 3, 2), Points: []image.Point{{1, 1}, {2, 2}}}, false},
+		{Constraint{Kind: ConstraintBorder, Tiles: []string{"a:1"}}, true},
+		{Constraint{Kind: ConstraintBorder, Tiles: []string{"a:0"}, Region: image.Rect(1, 1, 3, 3)}, false},
+	} {
+		c, _ := test.c.within(image.Rect(0, 0, 4, 4))
+		if err := c.Check(result, GridSquare); (err == nil) != test.ok {
+			t.Fatalf("%s %v: got %v, want ok %t", c.Kind, c.Tiles, err, test.ok)
+		}
+	}
+}
+
+func TestConstrainWFC(t *testing.T) {
+	m := NewMap(16, 16, nil)
+	for y, row := range []string{"111111", "100201", "102001", "100021", "120001", "111111"} {
+		for x, c := range row {
+			m.Layers[0].Tilemap.Put(Stack{{Spritesheet: "a", Index: int(c - '0')}}, x, y)
+		}
+	}
+	rect := image.Rect(10, 0, 20, 10)
+	m.Constraints = []Constraint{
+		{Kind: ConstraintCount, Tiles: []string{"a:2"}, Min: 2, Max: atMost(3)},
+		{Kind: ConstraintBorder, Tiles: []string{"a:1"}},
+		{Kind: ConstraintConnected, Tiles: []string{"a:0"}, Points: []image.Point{{11, 1}, {18, 8}, {11, 8}}},
+		// doesn't lie within rect
+		{Kind: ConstraintCount, Tiles: []string{"a:1"}, Region: image.Rect(0, 0, 12, 12), Max: atMost(1)},
+	}
+	for seed := int64(0); seed < 8; seed++ {
+		gen, err := m.NewGeneration(nil, image.Rectangle{}, rect, "wfc", nil, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gen.Constraints) != 3 {
+			t.Fatalf("expected 3 constraints within %v, got %d", rect, len(gen.Constraints))
+		}
+		for !gen.Step(1) {
+		}
+		if gen.Err != nil {
+			t.Fatalf("seed %d: %v", seed, gen.Err)
+		}
+		for _, c := range gen.Constraints {
+			c, _ := c.within(rect)
+			if err := c.Check(gen.Result(), GridSquare); err != nil {
+				t.Fatalf("seed %d: %s: %v", seed, c.Kind, err)
+			}
+		}
+	}
+	if _, err := m.NewGeneration(nil, image.Rectangle{}, rect, "greedy", nil, 1); err == nil {
+		t.Fatal("expected greedy not to support constraints")
+	}
+
+	buf, err := json.Marshal(m.Constraints[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf), `{"Kind":"count","Tiles":["a:2"],"Region":{"Min":{"X":0,"Y":0},"Max":{"X":0,"Y":0}},"Min":2,"Max":3}`; got != want {
+		t.Fatalf("wrong JSON, got %s, want %s", got, want)
+	}
+}
+
+func TestConstrainNone(t *testing.T) {
+	m := NewMap(16, 16, nil)
+	for y, row := range []string{"1112", "1211", "1111", "2111"} {
+		for x, c := range row {
+			m.Layers[0].Tilemap.Put(Stack{{Spritesheet: "a", Index: int(c - '0')}}, x, y)
+		}
+	}
+	// at most none of a:2 leaves only a:1
+	m.Constraints = []Constraint{{Kind: ConstraintCount, Tiles: []string{"a:2"}, Max: atMost(0)}}
+	for seed := int64(0); seed < 8; seed++ {
+		gen, err := m.NewGeneration(nil, image.Rectangle{}, image.Rect(10, 0, 16, 6), "wfc", nil, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for !gen.Step(1) {
+		}
+		if gen.Err != nil {
+			t.Fatalf("seed %d: %v", seed, gen.Err)
+		}
+		for _, col := range gen.Result() {
+			for _, stack := range col {
+				if stack.Hash() == "a:2" {
+					t.Fatalf("seed %d: expected a:2 to be banned", seed)
+				}
+			}
+		}
+	}
+}
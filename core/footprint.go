@@ -0,0 +1,129 @@
+package core
+
+import (
+	"image"
+)
+
+/*
+Tiles may be larger than the cells of the map they're placed on, e.g. 16x32 trees on a 16x16 grid. Such a tile is
+anchored to the bottom left corner of its cell and overdraws the cells above and to the right of it, which make up its
+footprint. Generators keep the footprints of tiles on the same level of a stack from overlapping, so two trees never
+grow into each other, while the ground beneath them on a lower level is unaffected.
+*/
+
+// size is the size of t as drawn, in pixels
+func (ts *Tileset) size(t *Tile) image.Point {
+	sheet := ts.Spritesheets[t.Spritesheet]
+	if sheet == nil {
+		return image.Point{}
+	}
+	if t.Flip&FlipDiagonal != 0 {
+		return image.Pt(sheet.TileHeight, sheet.TileWidth)
+	}
+	return image.Pt(sheet.TileWidth, sheet.TileHeight)
+}
+
+// Footprint is the cells t covers when drawn on cellWidth x cellHeight cells, relative to the cell it's placed on
+func (ts *Tileset) Footprint(t *Tile, cellWidth, cellHeight int) image.Rectangle {
+	size := ts.size(t)
+	cols := max(1, (size.X+cellWidth-1)/cellWidth)
+	rows := max(1, (size.Y+cellHeight-1)/cellHeight)
+	return image.Rect(0, 1-rows, cols, 1)
+}
+
+// Anchor is where the top left corner of t is drawn relative to that of its cell on cellWidth x cellHeight cells,
+// moved by the offset of its spritesheet and up by as much as it's taller than the cell
+func (ts *Tileset) Anchor(t *Tile, cellWidth, cellHeight int) image.Point {
+	p := ts.Offset(t)
+	if h := ts.size(t).Y; h > cellHeight {
+		p.Y -= h - cellHeight
+	}
+	return p
+}
+
+// Oversized is true if t is drawn past the edges of its cell on cellWidth x cellHeight cells
+func (ts *Tileset) Oversized(t *Tile, cellWidth, cellHeight int) bool {
+	p, size := ts.Anchor(t, cellWidth, cellHeight), ts.size(t)
+	return p.X < 0 || p.Y < 0 || p.X+size.X > cellWidth || p.Y+size.Y > cellHeight
+}
+
+// Overdraw is how far past the edges of their cells the tiles of ts may be drawn on cellWidth x cellHeight cells, in
+// pixels: Min is how far up and left, and Max how far down and right
+func (ts *Tileset) Overdraw(cellWidth, cellHeight int) image.Rectangle {
+	var r image.Rectangle
+	for name := range ts.Spritesheets {
+		for _, f := range []Flip{0, FlipDiagonal} {
+			t := &Tile{Spritesheet: name, Flip: f}
+			p, size := ts.Anchor(t, cellWidth, cellHeight), ts.size(t)
+			r.Min.X, r.Min.Y = min(r.Min.X, p.X), min(r.Min.Y, p.Y)
+			r.Max.X, r.Max.Y = max(r.Max.X, p.X+size.X-cellWidth), max(r.Max.Y, p.Y+size.Y-cellHeight)
+		}
+	}
+	return r
+}
+
+// Footprint returns a with the Footprints of the entries of its domain on cellWidth x cellHeight cells, or a itself if
+// every tile fits its cell. Tiles aren't kept apart on hex grids.
+func (a *Analysis) Footprint(tileset *Tileset, cellWidth, cellHeight int) *Analysis {
+	if tileset == nil || a.Grid.Hexagonal() {
+		return a
+	}
+	cell := image.Rect(0, 0, 1, 1)
+	footprints := make([][]image.Rectangle, len(a.Domain))
+	oversized := false
+	for i, stack := range a.Domain {
+		footprints[i] = make([]image.Rectangle, len(stack))
+		for z, t := range stack {
+			if t == nil {
+				continue
+			}
+			footprints[i][z] = tileset.Footprint(t, cellWidth, cellHeight)
+			if footprints[i][z] != cell {
+				oversized = true
+			}
+		}
+	}
+	if !oversized {
+		return a
+	}
+	footprinted := *a
+	footprinted.Footprints = footprints
+	return &footprinted
+}
+
+// Overlaps is true if the footprints of entry i and of entry j placed d cells away from it cover the same cell on the
+// same level
+func (a *Analysis) Overlaps(i, j int, d image.Point) bool {
+	if a.Footprints == nil {
+		return false
+	}
+	fi, fj := a.Footprints[i], a.Footprints[j]
+	for z := 0; z < len(fi) && z < len(fj); z++ {
+		if fi[z].Overlaps(fj[z].Add(d)) {
+			return true
+		}
+	}
+	return false
+}
+
+// reach lists how far apart two cells can be for the footprints of their entries to overlap, nil if none can
+func (a *Analysis) reach() []image.Point {
+	var r image.Rectangle
+	for _, fs := range a.Footprints {
+		for _, f := range fs {
+			r = r.Union(f)
+		}
+	}
+	if r.Empty() {
+		return nil
+	}
+	var reach []image.Point
+	for dx := r.Min.X - r.Max.X + 1; dx < r.Max.X-r.Min.X; dx++ {
+		for dy := r.Min.Y - r.Max.Y + 1; dy < r.Max.Y-r.Min.Y; dy++ {
+			if dx != 0 || dy != 0 {
+				reach = append(reach, image.Pt(dx, dy))
+			}
+		}
+	}
+	return reach
+}
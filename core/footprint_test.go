@@ -0,0 +1,93 @@
+package core
+
+import (
+	"encoding/json"
+	"image"
+	"testing"
+)
+
+func treesTileset() *Tileset {
+	ts := NewTileset()
+	ts.Spritesheets["ground"] = &Spritesheet{Name: "ground", TileWidth: 16, TileHeight: 16, Width: 2, Height: 2}
+	ts.Spritesheets["trees"] = &Spritesheet{Name: "trees", TileWidth: 16, TileHeight: 32, Width: 2, Height: 1}
+	return ts
+}
+
+func TestFootprint(t *testing.T) {
+	ts := treesTileset()
+	tree, grass := &Tile{Spritesheet: "trees"}, &Tile{Spritesheet: "ground"}
+	if got, want := ts.Footprint(tree, 16, 16), image.Rect(0, -1, 1, 1); got != want {
+		t.Fatalf("wrong footprint, got %v, want %v", got, want)
+	}
+	if got, want := ts.Footprint(&Tile{Spritesheet: "trees", Flip: FlipDiagonal}, 16, 16), image.Rect(0, 0, 2, 1); got != want {
+		t.Fatalf("wrong footprint of a rotated tree, got %v, want %v", got, want)
+	}
+	if got, want := ts.Anchor(tree, 16, 16), image.Pt(0, -16); got != want {
+		t.Fatalf("wrong anchor, got %v, want %v", got, want)
+	}
+	if !ts.Oversized(tree, 16, 16) || ts.Oversized(grass, 16, 16) || ts.Oversized(tree, 16, 32) {
+		t.Fatal("expected only trees to be larger than 16x16 cells")
+	}
+	if got, want := ts.Overdraw(16, 16), image.Rect(0, -16, 16, 0); got != want {
+		t.Fatalf("wrong overdraw, got %v, want %v", got, want)
+	}
+}
+
+func TestGenerateFootprints(t *testing.T) {
+	// trees stand next to each other in every direction in the sample, but are twice as tall as a cell
+	m := NewMap(16, 16, treesTileset())
+	trees := m.AddLayer("Trees")
+	for y, row := range []string{"T..T..", "T..T..", "T.....", "T...T.", "....T.", "......"} {
+		for x, c := range row {
+			m.Layer("Layer 1").Tilemap.Put(Stack{{Spritesheet: "ground"}}, x, y)
+			if c == 'T' {
+				trees.Tilemap.Put(Stack{{Spritesheet: "trees"}}, x, y)
+			}
+		}
+	}
+	for _, alg := range []string{"greedy", "wfc"} {
+		gen, err := m.NewGeneration(nil, image.Rectangle{}, image.Rect(0, 0, 12, 12), alg, nil, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gen.analysis.Footprints) != len(gen.analysis.Domain) {
+			t.Fatalf("%s: expected footprints for every entry, got %v", alg, gen.analysis.Footprints)
+		}
+		for !gen.Step(1) {
+		}
+		if gen.Err != nil {
+			t.Fatal(gen.Err)
+		}
+		result, placed := gen.Result(), 0
+		for x, col := range result {
+			for y, stack := range col {
+				if len(stack) < 2 || stack[1] == nil {
+					continue
+				}
+				placed++
+				if y > 0 && len(col[y-1]) > 1 && col[y-1][1] != nil {
+					t.Fatalf("%s: tree at %d, %d grows into the one above it", alg, x, y)
+				}
+			}
+		}
+		if placed == 0 {
+			t.Fatalf("%s: expected some trees", alg)
+		}
+	}
+
+	gen, err := m.NewGeneration(nil, image.Rectangle{}, image.Rect(0, 0, 4, 4), "wfc", nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := json.Marshal(gen.analysis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := new(Analysis)
+	if err := json.Unmarshal(buf, rules); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.Footprints) != len(rules.Domain) {
+		t.Fatal("expected footprints to be kept with the rules")
+	}
+}
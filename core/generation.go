@@ -0,0 +1,209 @@
+package core
+
+import (
+	"fmt"
+	"image"
+)
+
+// Generation is a generator running over a region of the map, stepped incrementally so its progress
+// can be previewed before the result is accepted into the map
+type Generation struct {
+	Rect      image.Rectangle
+	Algorithm string
+	Options   Options
+	Seed      int64
+	Paused    bool
+	Finished  bool
+	Err       error
+	Steps     int
+	Layers    []string
+	// Constraints are the constraints followed as well as the rules, by position on the map, see Constrain
+	Constraints []Constraint
+	generator   Generator
+	result      [][]Stack
+	analysis    *Analysis
+	tileset     *Tileset
+	// fixed are the tiles kept in place, by their position on the map
+	fixed Tilemap
+}
+
+// NewGeneration starts generating rect from sample's rules, keeping the tiles of fixed
+func NewGeneration(sample, fixed Tilemap, grid Grid, tileset *Tileset, rect image.Rectangle, algorithm string, opts Options, seed int64) (*Generation, error) {
+	a, err := LookupAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	analysis, err := a.Analysis(sample, grid, tileset, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewRulesetGeneration(analysis, fixed, tileset, rect, algorithm, opts, seed)
+}
+
+// NewRulesetGeneration is NewGeneration following the rules of analysis
+func NewRulesetGeneration(analysis *Analysis, fixed Tilemap, tileset *Tileset, rect image.Rectangle, algorithm string, opts Options, seed int64) (*Generation, error) {
+	a, err := LookupAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	opts = a.Options(opts)
+	if tileset != nil {
+		// frames of animated tiles are kept as the animated tile the rules know
+		fixed = tileset.Unanimate(fixed)
+	}
+	kept, subMap := make(Tilemap), make(Tilemap)
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			if stack := fixed.Get(x, y); stack != nil {
+				kept.Put(stack, x, y)
+				subMap.Put(stack, x-rect.Min.X, y-rect.Min.Y)
+			}
+		}
+	}
+	// the generator works relative to rect, which may change which neighbors a hex grid has
+	offset := *analysis
+	offset.Grid = analysis.Grid.Offset(rect.Min.X, rect.Min.Y)
+	return &Generation{
+		Rect:      rect,
+		Algorithm: algorithm,
+		Options:   opts,
+		Seed:      seed,
+		generator: a.NewGenerator(&offset, tileset, rect.Dx(), rect.Dy(), subMap, seed, opts),
+		analysis:  analysis,
+		tileset:   tileset,
+		fixed:     kept,
+	}, nil
+}
+
+// Constrain makes the generation follow those of constraints whose region lies within Rect as well as its rules,
+// which only the wfc algorithm can, with tags standing for the tiles of the tileset that have them. It must be
+// called before the first Step.
+func (gen *Generation) Constrain(constraints []Constraint) error {
+	if gen.Steps > 0 {
+		return fmt.Errorf("generation of %v has already started", gen.Rect)
+	}
+	var within, relative []Constraint
+	for _, c := range constraints {
+		if r, ok := c.within(gen.Rect); ok {
+			within = append(within, c)
+			relative = append(relative, r.tagged(gen.tileset))
+		}
+	}
+	if len(relative) == 0 {
+		return nil
+	}
+	g, ok := gen.generator.(interface{ Constrain([]Constraint) })
+	if !ok {
+		return fmt.Errorf("algorithm %q doesn't support constraints", gen.Algorithm)
+	}
+	g.Constrain(relative)
+	gen.Constraints = within
+	return nil
+}
+
+// Step advances the generator by at most n steps, returning true once it is finished
+func (gen *Generation) Step(n int) bool {
+	for i := 0; i < n && !gen.Finished; i++ {
+		gen.Finished = gen.generator.Done()
+		gen.Steps++
+		gen.result = nil
+	}
+	if gen.Finished {
+		if g, ok := gen.generator.(interface{ Err() error }); ok {
+			gen.Err = g.Err()
+		}
+	}
+	return gen.Finished
+}
+
+// Result is the current, possibly partial, output of the generator, indexed relative to Rect
+func (gen *Generation) Result() [][]Stack {
+	if gen.result == nil {
+		gen.result = gen.generator.Result()
+	}
+	return gen.result
+}
+
+// Entropy returns the entropy of the cell at x, y relative to Rect, normalized to [0, 1], or false if the
+// generator doesn't track entropy
+func (gen *Generation) Entropy(x, y int) (float64, bool) {
+	if g, ok := gen.generator.(interface{ Entropy(x, y int) float64 }); ok {
+		return g.Entropy(x, y), true
+	}
+	return 0, false
+}
+
+// NewGeneration starts generating rect from the named layers of m, or all of them if layers is nil
+func (m *Map) NewGeneration(layers []string, fixed, rect image.Rectangle, algorithm string, opts Options, seed int64) (*Generation, error) {
+	if layers == nil {
+		layers = m.LayerNames()
+	}
+	sample := m.Combine(layers)
+	analysis, err := m.rules(sample, algorithm, opts)
+	if err != nil {
+		return nil, err
+	}
+	gen, err := NewRulesetGeneration(analysis, sample.Sub(fixed.Intersect(rect)), m.Tileset, rect, algorithm, opts, seed)
+	if err != nil {
+		return nil, err
+	}
+	if err := gen.Constrain(m.Constraints); err != nil {
+		return nil, err
+	}
+	gen.Layers = layers
+	return gen, nil
+}
+
+// rules are the rules generations of m follow, its Ruleset if it has one or else those algorithm learns from sample,
+// with the footprints of tiles larger than the map's cells
+func (m *Map) rules(sample Tilemap, algorithm string, opts Options) (*Analysis, error) {
+	analysis := m.Ruleset
+	if analysis == nil {
+		a, err := LookupAlgorithm(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		if analysis, err = a.Analysis(sample, m.Grid, m.Tileset, opts); err != nil {
+			return nil, err
+		}
+	} else if analysis.Grid != m.Grid {
+		return nil, fmt.Errorf("ruleset is for a %s grid, not %s", analysis.Grid, m.Grid)
+	}
+	return analysis.Footprint(m.Tileset, m.TileWidth, m.TileHeight), nil
+}
+
+// Apply writes the result of a finished generation into the layers of m it was generated from, creating any
+// that are missing and skipping any that are locked, recording it as a single edit if history is not nil. The
+// generation is added to m's Generations so it can be run again.
+func (gen *Generation) Apply(m *Map, history *History) error {
+	if !gen.Finished {
+		return fmt.Errorf("generation of %v is not finished", gen.Rect)
+	}
+	if gen.Err != nil {
+		return gen.Err
+	}
+	for _, name := range gen.Layers {
+		m.AddLayer(name)
+	}
+	if err := m.record(gen); err != nil {
+		return err
+	}
+	result := gen.Result()
+	if history != nil {
+		history.Begin("generate")
+		defer history.Commit()
+	}
+	for x := 0; x < len(result); x++ {
+		for y := 0; y < len(result[x]); y++ {
+			if result[x][y] != nil {
+				mx, my := x+gen.Rect.Min.X, y+gen.Rect.Min.Y
+				m.Split(gen.Layers, result[x][y], mx, my, func(l *Layer, before, after Stack) {
+					if history != nil {
+						history.Record(l.Name, mx, my, before, after)
+					}
+				})
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Generator incrementally fills a width x height region, Done is called until it returns true
+type Generator interface {
+	Done() bool
+	Result() [][]Stack
+}
+
+// Options are the integer parameters passed to an algorithm, keyed by Param name
+type Options map[string]int
+
+// Param describes a tunable parameter of an algorithm
+type Param struct {
+	Name     string
+	Default  int
+	Min, Max int
+}
+
+// Algorithm is a named way of generating a region of the map from a sample
+type Algorithm struct {
+	Name   string
+	Params []Param
+	// Analyze learns the rules the generator follows from the sample, defaults to Analyze
+	Analyze func(sample Tilemap, opts Options) *Analysis
+	New     func(analysis *Analysis, width, height int, fixed Tilemap, seed int64, opts Options) Generator
+}
+
+var algorithms = make(map[string]*Algorithm)
+
+// RegisterAlgorithm makes an algorithm available by name to Map.Generate and the Editor
+func RegisterAlgorithm(a *Algorithm) {
+	if _, ok := algorithms[a.Name]; ok {
+		panic(fmt.Errorf("algorithm %q registered twice", a.Name))
+	}
+	algorithms[a.Name] = a
+}
+
+func LookupAlgorithm(name string) (*Algorithm, error) {
+	a := algorithms[name]
+	if a == nil {
+		return nil, fmt.Errorf("unknown algorithm %q", name)
+	}
+	return a, nil
+}
+
+func AlgorithmNames() []string {
+	var names []string
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options returns opts with defaults filled in and every value clamped to its Param's range
+func (a *Algorithm) Options(opts Options) Options {
+	r := make(Options)
+	for _, p := range a.Params {
+		v, ok := opts[p.Name]
+		if !ok {
+			v = p.Default
+		}
+		r[p.Name] = max(p.Min, min(p.Max, v))
+	}
+	return r
+}
+
+// Analysis learns the algorithm's rules from sample on grid, using tileset if it isn't nil
+func (a *Algorithm) Analysis(sample Tilemap, grid Grid, tileset *Tileset, opts Options) (*Analysis, error) {
+	opts = a.Options(opts)
+	if tileset != nil {
+		sample = tileset.Unanimate(sample)
+	}
+	if a.Analyze != nil {
+		if grid != GridSquare {
+			return nil, fmt.Errorf("algorithm %q only supports %s grids", a.Name, GridSquare)
+		}
+		return a.Analyze(sample, opts), nil
+	}
+	if tileset == nil {
+		return Analyze(sample, grid), nil
+	}
+	var analysis *Analysis
+	switch opts["sockets"] {
+	case SocketsOnly:
+		analysis = AnalyzeSockets(tileset, grid)
+	case SocketsMerged:
+		analysis = Analyze(sample, grid).Merge(AnalyzeSockets(tileset, grid))
+	default:
+		analysis = Analyze(sample, grid)
+	}
+	return analysis.Expand(tileset).Weigh(tileset), nil
+}
+
+// Generator learns from sample and returns a generator for a width x height region, see Analysis
+func (a *Algorithm) Generator(sample Tilemap, grid Grid, tileset *Tileset, width, height int, fixed Tilemap, seed int64, opts Options) (Generator, error) {
+	analysis, err := a.Analysis(sample, grid, tileset, opts)
+	if err != nil {
+		return nil, err
+	}
+	return a.NewGenerator(analysis, tileset, width, height, fixed, seed, opts), nil
+}
+
+// NewGenerator returns a width x height generator following the rules of analysis
+func (a *Algorithm) NewGenerator(analysis *Analysis, tileset *Tileset, width, height int, fixed Tilemap, seed int64, opts Options) Generator {
+	if a.Analyze == nil && tileset != nil {
+		fixed = canonicalTilemap(fixed, tileset)
+	}
+	return a.New(analysis, width, height, fixed, seed, a.Options(opts))
+}
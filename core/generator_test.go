@@ -0,0 +1,45 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAlgorithmOptions(t *testing.T) {
+	a, err := LookupAlgorithm("overlapping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := a.Options(Options{"N": 0, "symmetry": 12, "unknown": 1})
+	want := Options{"N": 1, "symmetry": 8, "periodic": 0, "backtracks": DefaultBacktracks, "retries": DefaultRetries}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong options, got %v, want %v", got, want)
+	}
+	if _, err := LookupAlgorithm("missing"); err == nil {
+		t.Fatal("expected error for unknown algorithm")
+	}
+}
+
+func TestAlgorithmGenerator(t *testing.T) {
+	m := make(Tilemap)
+	a, b := &Tile{Spritesheet: "a", Index: 1}, &Tile{Spritesheet: "b", Index: 2}
+	m.Set(a, 0, 0, false, 0)
+	m.Set(b, 1, 0, false, 0)
+	m.Set(b, 0, 1, false, 0)
+	m.Set(a, 1, 1, false, 0)
+	for _, name := range AlgorithmNames() {
+		alg, err := LookupAlgorithm(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := alg.Generator(m, GridSquare, nil, 4, 4, nil, 1, Options{"N": 2, "periodic": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for !g.Done() {
+		}
+		if got, want := len(g.Result()), 4; got != want {
+			t.Fatalf("%s: wrong width, got %d, want %d", name, got, want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
-package main
+package core
 
 import (
+	"image"
 	"math/rand"
 )
 
@@ -10,34 +11,57 @@ GreedyBFS: greedily expand around any fixed tiles
 type GreedyBFS struct {
 	*Analysis
 	queue         [][2]int
+	queued        *NDArray[bool]
 	result        *NDArray[*int]
 	width, height int
 	rng           *rand.Rand
+	// reach is how far apart cells can be for the footprints of their entries to overlap
+	reach []image.Point
+}
+
+func init() {
+	RegisterAlgorithm(&Algorithm{
+		Name:   "greedy",
+		Params: []Param{{Name: "sockets", Default: SocketsOff, Min: SocketsOff, Max: SocketsMerged}},
+		New: func(analysis *Analysis, width, height int, fixed Tilemap, seed int64, opts Options) Generator {
+			return NewGreedyBFS(analysis, width, height, fixed, seed)
+		},
+	})
 }
 
 func NewGreedyBFS(analysis *Analysis, width, height int, fixed Tilemap, seed int64) *GreedyBFS {
 	g := &GreedyBFS{
 		Analysis: analysis,
+		queued:   NewNDArray[bool](width, height),
 		result:   NewNDArray[*int](width, height),
 		width:    width,
 		height:   height,
 		rng:      rand.New(rand.NewSource(seed)),
+		reach:    analysis.reach(),
 	}
 	for x := 0; x < width; x++ {
 		for y := 0; y < height; y++ {
-			if fixed[x][y] != nil {
-				g.queue = append(g.queue, [2]int{x, y})
-				i := g.DomainIndex[fixed[x][y].Hash()]
+			if stack := fixed.Get(x, y); stack != nil {
+				g.enqueue(x, y)
+				i := g.DomainIndex[stack.Hash()]
 				g.result.Set(&i, x, y)
 			}
 		}
 	}
 	if len(g.queue) == 0 {
-		g.queue = append(g.queue, [2]int{0, 0})
+		g.enqueue(0, 0)
 	}
 	return g
 }
 
+// enqueue adds x, y to the queue unless it has already been queued
+func (g *GreedyBFS) enqueue(x, y int) {
+	if !g.queued.At(x, y) {
+		g.queued.Set(true, x, y)
+		g.queue = append(g.queue, [2]int{x, y})
+	}
+}
+
 func (g *GreedyBFS) Done() bool {
 	if len(g.queue) == 0 {
 		return true
@@ -47,13 +71,13 @@ func (g *GreedyBFS) Done() bool {
 	x, y := curr[0], curr[1]
 	if g.result.At(x, y) == nil {
 		banned := make([]bool, len(g.Domain))
-		for d, o := range Neighbors {
-			nx, ny := x+o[0], y+o[1]
+		for _, d := range g.Grid.Directions() {
+			nx, ny := g.Grid.Neighbor(x, y, d)
 			if nx < 0 || ny < 0 || nx >= g.width || ny >= g.height {
 				continue
 			}
 			if n := g.result.At(nx, ny); n != nil {
-				adj := g.Adj.At(*n, int(Direction(d).Inverse()))
+				adj := g.Adj.At(*n, int(d.Inverse()))
 				for i := range banned {
 					if !adj[i] {
 						banned[i] = true
@@ -61,6 +85,20 @@ func (g *GreedyBFS) Done() bool {
 				}
 			}
 		}
+		// nor may its footprint overlap those of the tiles placed around it
+		for _, d := range g.reach {
+			nx, ny := x-d.X, y-d.Y
+			if nx < 0 || ny < 0 || nx >= g.width || ny >= g.height {
+				continue
+			}
+			if n := g.result.At(nx, ny); n != nil {
+				for i := range banned {
+					if g.Overlaps(*n, i, d) {
+						banned[i] = true
+					}
+				}
+			}
+		}
 		winner := g.Lottery(g.rng, func(i int) bool {
 			return !banned[i]
 		})
@@ -69,13 +107,13 @@ func (g *GreedyBFS) Done() bool {
 		}
 		g.result.Set(&winner, x, y)
 	}
-	for _, o := range Neighbors {
-		nx, ny := x+o[0], y+o[1]
+	for _, d := range g.Grid.Directions() {
+		nx, ny := g.Grid.Neighbor(x, y, d)
 		if nx < 0 || ny < 0 || nx >= g.width || ny >= g.height {
 			continue
 		}
 		if g.result.At(nx, ny) == nil {
-			g.queue = append(g.queue, [2]int{nx, ny})
+			g.enqueue(nx, ny)
 		}
 	}
 	return false
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+/*
+Grid is the topology of a map: which cells are neighbors, and where each cell is drawn. Cells are always addressed
+by integer x, y. Hexagonal grids use offset coordinates as Tiled does with a stagger index of odd, pointy topped
+hexes shift every odd row half a tile to the right, and flat topped hexes shift every odd column half a tile down.
+A hex tile is drawn in a tileWidth x tileHeight box, and neighboring rows (or columns) overlap by a quarter of it.
+*/
+type Grid uint8
+
+const (
+	// GridSquare has 4 neighbors per cell
+	GridSquare = Grid(iota)
+	// GridSquare8 has 8 neighbors per cell, including the diagonals
+	GridSquare8
+	// GridHexPointy has 6 neighbors per cell, west, east and the diagonals
+	GridHexPointy
+	// GridHexFlat has 6 neighbors per cell, north, south and the diagonals
+	GridHexFlat
+	// hex grids whose even rows or columns are shifted, as seen relative to an odd origin, see Offset
+	gridHexPointyEven
+	gridHexFlatEven
+)
+
+var gridNames = []string{"square", "square8", "hex-pointy", "hex-flat"}
+
+// Grids lists every grid in the order the editor cycles through them
+var Grids = []Grid{GridSquare, GridSquare8, GridHexPointy, GridHexFlat}
+
+var gridDirections = [][]Direction{
+	{North, South, West, East},
+	{North, South, West, East, NorthWest, SouthEast, NorthEast, SouthWest},
+	{West, East, NorthWest, SouthEast, NorthEast, SouthWest},
+	{North, South, NorthWest, SouthEast, NorthEast, SouthWest},
+}
+
+// hexNeighbors are the offsets of each Direction in a hexagonal grid, for even and odd rows of pointy grids or
+// columns of flat ones
+var hexNeighbors = [2][2][NumDirections][2]int{
+	// pointy
+	{
+		{{}, {}, {-1, 0}, {1, 0}, {-1, -1}, {0, 1}, {0, -1}, {-1, 1}},
+		{{}, {}, {-1, 0}, {1, 0}, {0, -1}, {1, 1}, {1, -1}, {0, 1}},
+	},
+	// flat
+	{
+		{{0, -1}, {0, 1}, {}, {}, {-1, -1}, {1, 0}, {1, -1}, {-1, 0}},
+		{{0, -1}, {0, 1}, {}, {}, {-1, 0}, {1, 1}, {1, 0}, {-1, 1}},
+	},
+}
+
+func (g Grid) String() string {
+	if int(g) < len(gridNames) {
+		return gridNames[g]
+	}
+	return fmt.Sprintf("Grid(%d)", g)
+}
+
+func (g Grid) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+func (g *Grid) UnmarshalText(text []byte) error {
+	for i, name := range gridNames {
+		if string(text) == name {
+			*g = Grid(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown grid %q", text)
+}
+
+// Hexagonal is true for both hex grids
+func (g Grid) Hexagonal() bool {
+	return g.base() == GridHexPointy || g.base() == GridHexFlat
+}
+
+func (g Grid) base() Grid {
+	switch g {
+	case gridHexPointyEven:
+		return GridHexPointy
+	case gridHexFlatEven:
+		return GridHexFlat
+	}
+	return g
+}
+
+// Offset returns the grid with its origin moved to x, y, so that a generator working on a region of the map
+// relative to its top left corner sees the same neighbors as the map does
+func (g Grid) Offset(x, y int) Grid {
+	switch {
+	case g == GridHexPointy && y&1 != 0:
+		return gridHexPointyEven
+	case g == gridHexPointyEven && y&1 != 0:
+		return GridHexPointy
+	case g == GridHexFlat && x&1 != 0:
+		return gridHexFlatEven
+	case g == gridHexFlatEven && x&1 != 0:
+		return GridHexFlat
+	}
+	return g
+}
+
+// Directions lists the directions of the neighbors of each cell, in inverse pairs
+func (g Grid) Directions() []Direction {
+	if int(g.base()) < len(gridDirections) {
+		return gridDirections[g.base()]
+	}
+	return gridDirections[GridSquare]
+}
+
+// Neighbor returns the cell next to x, y in direction d
+func (g Grid) Neighbor(x, y int, d Direction) (int, int) {
+	var o [2]int
+	switch g {
+	case GridHexPointy:
+		o = hexNeighbors[0][y&1][d]
+	case gridHexPointyEven:
+		o = hexNeighbors[0][(y+1)&1][d]
+	case GridHexFlat:
+		o = hexNeighbors[1][x&1][d]
+	case gridHexFlatEven:
+		o = hexNeighbors[1][(x+1)&1][d]
+	default:
+		o = Neighbors[d]
+	}
+	return x + o[0], y + o[1]
+}
+
+// Position returns the top left corner of the tileWidth x tileHeight box the cell at x, y is drawn in
+func (g Grid) Position(x, y int, tileWidth, tileHeight float64) (float64, float64) {
+	switch g {
+	case GridHexPointy:
+		return (float64(x) + float64(y&1)/2) * tileWidth, float64(y) * tileHeight * 3 / 4
+	case GridHexFlat:
+		return float64(x) * tileWidth * 3 / 4, (float64(y) + float64(x&1)/2) * tileHeight
+	default:
+		return float64(x) * tileWidth, float64(y) * tileHeight
+	}
+}
+
+// Cell returns the cell drawn at pixel px, py, the inverse of Position
+func (g Grid) Cell(px, py float64, tileWidth, tileHeight float64) (int, int) {
+	switch g {
+	case GridHexPointy:
+		y := int(math.Floor(py / (tileHeight * 3 / 4)))
+		x := int(math.Floor(px/tileWidth - float64(y&1)/2))
+		ox, oy := g.Position(x, y, tileWidth, tileHeight)
+		// within the top quarter of the box the corners belong to the row above
+		lx, ly := (px-ox)/(tileWidth/2), (py-oy)/(tileHeight/4)
+		if ly < 1-lx {
+			return g.Neighbor(x, y, NorthWest)
+		} else if ly < lx-1 {
+			return g.Neighbor(x, y, NorthEast)
+		}
+		return x, y
+	case GridHexFlat:
+		x := int(math.Floor(px / (tileWidth * 3 / 4)))
+		y := int(math.Floor(py/tileHeight - float64(x&1)/2))
+		ox, oy := g.Position(x, y, tileWidth, tileHeight)
+		// within the left quarter of the box the corners belong to the column to the left
+		lx, ly := (px-ox)/(tileWidth/4), (py-oy)/(tileHeight/2)
+		if lx < 1-ly {
+			return g.Neighbor(x, y, NorthWest)
+		} else if lx < ly-1 {
+			return g.Neighbor(x, y, SouthWest)
+		}
+		return x, y
+	default:
+		return int(math.Floor(px / tileWidth)), int(math.Floor(py / tileHeight))
+	}
+}
+
+// Bounds returns the pixels covered by drawing the cells of rect, relative to the position of rect.Min
+func (g Grid) Bounds(rect image.Rectangle, tileWidth, tileHeight int) image.Rectangle {
+	if rect.Empty() {
+		return image.Rectangle{}
+	}
+	w, h := float64(tileWidth), float64(tileHeight)
+	ox, oy := g.Position(rect.Min.X, rect.Min.Y, w, h)
+	var bounds image.Rectangle
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			// only the cells along the edges can extend the bounds
+			if x > rect.Min.X+1 && x < rect.Max.X-2 && y > rect.Min.Y+1 && y < rect.Max.Y-2 {
+				continue
+			}
+			px, py := g.Position(x, y, w, h)
+			cell := image.Rect(int(math.Floor(px-ox)), int(math.Floor(py-oy)), int(math.Ceil(px-ox+w)), int(math.Ceil(py-oy+h)))
+			bounds = bounds.Union(cell)
+		}
+	}
+	return bounds
+}
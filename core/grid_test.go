@@ -0,0 +1,132 @@
+package core
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestGridNeighbors(t *testing.T) {
+	grids := append([]Grid{gridHexPointyEven, gridHexFlatEven}, Grids...)
+	for _, g := range grids {
+		want := map[Grid]int{GridSquare: 4, GridSquare8: 8, GridHexPointy: 6, GridHexFlat: 6}[g.base()]
+		if got := len(g.Directions()); got != want {
+			t.Fatalf("%s: wrong number of directions, got %d, want %d", g, got, want)
+		}
+		for x := -3; x < 3; x++ {
+			for y := -3; y < 3; y++ {
+				seen := make(map[[2]int]bool)
+				for _, d := range g.Directions() {
+					nx, ny := g.Neighbor(x, y, d)
+					if seen[[2]int{nx, ny}] || (nx == x && ny == y) {
+						t.Fatalf("%s: neighbor %s of %d, %d repeats %d, %d", g, d, x, y, nx, ny)
+					}
+					seen[[2]int{nx, ny}] = true
+					if bx, by := g.Neighbor(nx, ny, d.Inverse()); bx != x || by != y {
+						t.Fatalf("%s: %s of %d, %d is %d, %d whose %s is %d, %d", g, d, x, y, nx, ny, d.Inverse(), bx, by)
+					}
+				}
+			}
+		}
+	}
+	// seen from an odd origin, the neighbors of a hex are the same cells
+	for _, g := range []Grid{GridHexPointy, GridHexFlat} {
+		offset := g.Offset(3, 5)
+		for _, d := range g.Directions() {
+			nx, ny := g.Neighbor(4, 7, d)
+			ox, oy := offset.Neighbor(1, 2, d)
+			if ox+3 != nx || oy+5 != ny {
+				t.Fatalf("%s: wrong offset neighbor %s, got %d, %d, want %d, %d", g, d, ox+3, oy+5, nx, ny)
+			}
+		}
+	}
+}
+
+func TestGridCell(t *testing.T) {
+	for _, g := range Grids {
+		for x := -4; x < 4; x++ {
+			for y := -4; y < 4; y++ {
+				px, py := g.Position(x, y, 32, 48)
+				// the center and points near each corner of the hex or square
+				for _, o := range [][2]float64{{16, 24}, {16, 2}, {16, 46}, {2, 24}, {30, 24}, {9, 15}, {23, 33}} {
+					if cx, cy := g.Cell(px+o[0], py+o[1], 32, 48); cx != x || cy != y {
+						t.Fatalf("%s: wrong cell at %v in %d, %d, got %d, %d", g, o, x, y, cx, cy)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateHex(t *testing.T) {
+	ts := NewTileset()
+	ts.Spritesheets["a"] = &Spritesheet{Name: "a", TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	m := NewMap(32, 48, ts)
+	m.Grid = GridHexPointy
+	// rows alternate between tiles, so a hex's west and east neighbors match it and the rest don't
+	for x := 0; x < 6; x++ {
+		for y := 0; y < 6; y++ {
+			m.Layers[0].Tilemap.Put(Stack{{Spritesheet: "a", Index: y % 2}}, x, y)
+		}
+	}
+	analysis := Analyze(m.Combine(nil), m.Grid)
+	a, b := analysis.DomainIndex["a:0"], analysis.DomainIndex["a:1"]
+	if !analysis.Allowed(a, East, a) || analysis.Allowed(a, East, b) || !analysis.Allowed(a, SouthEast, b) || analysis.Allowed(a, SouthEast, a) {
+		t.Fatal("wrong hex adjacencies")
+	}
+	for _, alg := range []string{"wfc", "greedy"} {
+		// starting on an odd row, so the generator works on an offset grid
+		gen, err := m.NewGeneration(nil, image.Rect(0, 0, 6, 6), image.Rect(0, 3, 6, 9), alg, nil, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for !gen.Step(1) {
+		}
+		if err := gen.Apply(m, nil); err != nil {
+			t.Fatal(err)
+		}
+		for x := 0; x < 6; x++ {
+			for y := 0; y < 9; y++ {
+				if got, want := m.Layers[0].Tilemap.At(x, y, 0).Hash(), []string{"a:0", "a:1"}[y%2]; got != want {
+					t.Fatalf("%s: wrong tile at %d, %d, got %q, want %q", alg, x, y, got, want)
+				}
+			}
+		}
+	}
+	if _, err := m.NewGeneration(nil, image.Rectangle{}, image.Rect(0, 0, 4, 4), "overlapping", nil, 1); err == nil {
+		t.Fatal("expected the overlapping model to refuse a hex grid")
+	}
+}
+
+func TestTiledHex(t *testing.T) {
+	for _, g := range []Grid{GridHexPointy, GridHexFlat} {
+		m := tiledSample()
+		m.Grid = g
+		ground := m.Layers[0].Tilemap
+		ground.Put(nil, 0, 0)
+		ground.Put(nil, 2, 1)
+		ground.Put(Stack{{Spritesheet: "maps/a.png", Index: 1}}, 1, 1)
+		ground.Put(Stack{{Spritesheet: "maps/a.png", Index: 2}}, 2, 3)
+		m.Layers[1].Tilemap.Put(nil, 0, 0)
+		buf := new(bytes.Buffer)
+		if err := WriteTMX(buf, m, "maps"); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadTMX(buf, "maps")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Grid != g {
+			t.Fatalf("wrong grid, got %s, want %s", got.Grid, g)
+		}
+		// the map moves to the origin, but only by an even number of rows or columns
+		b := got.Layers[0].Tilemap.Bounds()
+		if b.Min.X&1 != 1 && g == GridHexFlat || b.Min.Y&1 != 1 && g == GridHexPointy {
+			t.Fatalf("%s: expected the top left tile to stay odd, got %v", g, b)
+		}
+		x, y := b.Min.X-1, b.Min.Y-1
+		if got.Layers[0].Tilemap.At(x+1, y+1, 0).Hash() != "maps/a.png:1" || got.Layers[0].Tilemap.At(x+2, y+3, 0).Hash() != "maps/a.png:2" {
+			t.Fatalf("%s: wrong tiles after round trip", g)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package core
+
+import "unsafe"
+
+// DefaultHistorySize bounds the memory held by undo/redo history, in bytes
+const DefaultHistorySize = 64 << 20
+
+// Change records the contents of a single cell of a layer before and after an edit
+type Change struct {
+	Layer         string
+	X, Y          int
+	Before, After Stack
+}
+
+// Edit is a single reversible step in the history, e.g. a brush stroke or a generated region
+type Edit struct {
+	Name    string
+	Changes []Change
+	cells   map[cell]int
+}
+
+type cell struct {
+	layer string
+	x, y  int
+}
+
+func (e *Edit) record(layer string, x, y int, before, after Stack) {
+	if i, ok := e.cells[cell{layer, x, y}]; ok {
+		// coalesce repeated changes to the same cell, keeping the original state
+		e.Changes[i].After = after
+		return
+	}
+	e.cells[cell{layer, x, y}] = len(e.Changes)
+	e.Changes = append(e.Changes, Change{Layer: layer, X: x, Y: y, Before: before, After: after})
+}
+
+// size estimates the memory held by the edit
+func (e *Edit) size() int {
+	n := int(unsafe.Sizeof(*e)) + len(e.Name)
+	for _, c := range e.Changes {
+		n += int(unsafe.Sizeof(c)) + len(c.Layer) + (len(c.Before)+len(c.After))*int(unsafe.Sizeof(&Tile{}))
+	}
+	return n
+}
+
+type History struct {
+	MaxSize    int
+	undo, redo []*Edit
+	pending    *Edit
+	depth      int
+	size       int
+}
+
+func NewHistory(maxSize int) *History {
+	return &History{MaxSize: maxSize}
+}
+
+// Begin starts grouping changes into a single edit, calls may be nested
+func (h *History) Begin(name string) {
+	if h.depth == 0 && h.pending == nil {
+		h.pending = &Edit{Name: name, cells: make(map[cell]int)}
+	}
+	h.depth++
+}
+
+// Commit finishes the edit started by the outermost call to Begin
+func (h *History) Commit() {
+	if h.depth == 0 {
+		return
+	}
+	h.depth--
+	if h.depth > 0 {
+		return
+	}
+	e := h.pending
+	h.pending = nil
+	if len(e.Changes) == 0 {
+		return
+	}
+	e.cells = nil
+	h.undo = append(h.undo, e)
+	h.size += e.size()
+	for _, r := range h.redo {
+		h.size -= r.size()
+	}
+	h.redo = nil
+	for h.size > h.MaxSize && len(h.undo) > 1 {
+		h.size -= h.undo[0].size()
+		h.undo[0] = nil
+		h.undo = h.undo[1:]
+	}
+}
+
+// Record adds a change to the pending edit, or commits it as its own edit if none is pending
+func (h *History) Record(layer string, x, y int, before, after Stack) {
+	h.Begin("")
+	h.pending.record(layer, x, y, before, after)
+	h.Commit()
+}
+
+func (h *History) CanUndo() bool {
+	return len(h.undo) > 0
+}
+
+func (h *History) CanRedo() bool {
+	return len(h.redo) > 0
+}
+
+// Undo reverts the most recent edit to m, returning false if there was nothing to undo
+func (h *History) Undo(m *Map) bool {
+	h.flush()
+	if len(h.undo) == 0 {
+		return false
+	}
+	e := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	for i := len(e.Changes) - 1; i >= 0; i-- {
+		c := e.Changes[i]
+		if l := m.Layer(c.Layer); l != nil {
+			l.Tilemap.Put(c.Before.Clone(), c.X, c.Y)
+		}
+	}
+	h.redo = append(h.redo, e)
+	return true
+}
+
+// Redo reapplies the most recently undone edit to m, returning false if there was nothing to redo
+func (h *History) Redo(m *Map) bool {
+	h.flush()
+	if len(h.redo) == 0 {
+		return false
+	}
+	e := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	for _, c := range e.Changes {
+		if l := m.Layer(c.Layer); l != nil {
+			l.Tilemap.Put(c.After.Clone(), c.X, c.Y)
+		}
+	}
+	h.undo = append(h.undo, e)
+	return true
+}
+
+// flush commits any edit still in progress
+func (h *History) flush() {
+	if h.depth > 0 {
+		h.depth = 1
+		h.Commit()
+	}
+}
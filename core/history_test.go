@@ -0,0 +1,66 @@
+package core
+
+import "testing"
+
+func TestHistory(t *testing.T) {
+	m := NewMap(16, 16, NewTileset())
+	ground, walls := m.Layer("Layer 1").Tilemap, m.AddLayer("walls").Tilemap
+	h := NewHistory(DefaultHistorySize)
+	a, b := &Tile{Spritesheet: "a", Index: 1}, &Tile{Spritesheet: "b", Index: 2}
+
+	// a brush stroke over the same cell is coalesced into a single edit
+	h.Begin("paint")
+	for _, tile := range []*Tile{a, b} {
+		before := ground.Get(0, 0).Clone()
+		ground.Put(Stack{tile}, 0, 0)
+		h.Record("Layer 1", 0, 0, before, Stack{tile})
+	}
+	h.Record("walls", 0, 0, nil, Stack{a})
+	walls.Put(Stack{a}, 0, 0)
+	h.Commit()
+
+	if got, want := len(h.undo), 1; got != want {
+		t.Fatalf("wrong number of edits, got %d, want %d", got, want)
+	}
+	if got, want := len(h.undo[0].Changes), 2; got != want {
+		t.Fatalf("wrong number of changes, got %d, want %d", got, want)
+	}
+	if !h.Undo(m) {
+		t.Fatal("expected undo")
+	}
+	if got := len(ground) + len(walls); got != 0 {
+		t.Fatalf("expected empty layers after undo, got %d columns", got)
+	}
+	if h.Undo(m) {
+		t.Fatal("expected nothing to undo")
+	}
+	if !h.Redo(m) {
+		t.Fatal("expected redo")
+	}
+	if got, want := ground.Get(0, 0).Hash(), "b:2"; got != want {
+		t.Fatalf("wrong stack after redo, got %q, want %q", got, want)
+	}
+	if got, want := walls.Get(0, 0).Hash(), "a:1"; got != want {
+		t.Fatalf("wrong stack after redo, got %q, want %q", got, want)
+	}
+
+	// a new edit clears the redo stack
+	h.Undo(m)
+	h.Record("walls", 2, 2, nil, Stack{a})
+	if h.CanRedo() {
+		t.Fatal("expected redo to be cleared")
+	}
+}
+
+func TestHistoryMaxSize(t *testing.T) {
+	h := NewHistory(0)
+	for i := 0; i < 10; i++ {
+		h.Record("Layer 1", i, 0, nil, Stack{{Spritesheet: "a", Index: 1}})
+	}
+	if got, want := len(h.undo), 1; got != want {
+		t.Fatalf("wrong number of edits, got %d, want %d", got, want)
+	}
+	if got, want := h.undo[0].Changes[0].X, 9; got != want {
+		t.Fatalf("wrong edit kept, got x=%d, want x=%d", got, want)
+	}
+}
@@ -0,0 +1,162 @@
+package core
+
+import "fmt"
+
+// Layer is a named tilemap drawn in order with the other layers of a map, holding at most one tile per cell
+type Layer struct {
+	Name    string
+	Visible bool
+	Locked  bool
+	Opacity float64
+	// Upright layers stand up at their cells in projected views rather than lying flat, see Projection
+	Upright bool `json:",omitempty"`
+	Tilemap Tilemap
+}
+
+func NewLayer(name string) *Layer {
+	return &Layer{
+		Name:    name,
+		Visible: true,
+		Opacity: 1,
+		Tilemap: make(Tilemap),
+	}
+}
+
+// Layer returns the layer called name, or nil if there is none
+func (m *Map) Layer(name string) *Layer {
+	for _, l := range m.Layers {
+		if l.Name == name {
+			return l
+		}
+	}
+	return nil
+}
+
+// AddLayer appends a new layer on top of the others, or returns the existing layer called name
+func (m *Map) AddLayer(name string) *Layer {
+	if l := m.Layer(name); l != nil {
+		return l
+	}
+	l := NewLayer(name)
+	m.Layers = append(m.Layers, l)
+	return l
+}
+
+// NewLayerName returns a name not yet used by any layer
+func (m *Map) NewLayerName() string {
+	for i := len(m.Layers) + 1; ; i++ {
+		if name := fmt.Sprintf("Layer %d", i); m.Layer(name) == nil {
+			return name
+		}
+	}
+}
+
+func (m *Map) RemoveLayer(name string) {
+	for i, l := range m.Layers {
+		if l.Name == name {
+			m.Layers = append(m.Layers[:i], m.Layers[i+1:]...)
+			return
+		}
+	}
+}
+
+// MoveLayer moves the layer called name up (delta > 0) or down the draw order
+func (m *Map) MoveLayer(name string, delta int) {
+	for i, l := range m.Layers {
+		if l.Name == name {
+			rest := append(append([]*Layer(nil), m.Layers[:i]...), m.Layers[i+1:]...)
+			j := min(max(i+delta, 0), len(rest))
+			m.Layers = append(rest[:j], append([]*Layer{l}, rest[j:]...)...)
+			return
+		}
+	}
+}
+
+// LayerNames lists every layer from the bottom up
+func (m *Map) LayerNames() []string {
+	names := make([]string, len(m.Layers))
+	for i, l := range m.Layers {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// Combine merges the named layers, or all layers if names is nil, into a single tilemap whose stacks have one
+// entry per layer in the order given, nil where a layer is empty, so it can be analyzed as a whole and the
+// result split back apart with Split
+func (m *Map) Combine(names []string) Tilemap {
+	if names == nil {
+		names = m.LayerNames()
+	}
+	combined := make(Tilemap)
+	for i, name := range names {
+		l := m.Layer(name)
+		if l == nil {
+			continue
+		}
+		l.Tilemap.Each(func(x, y int, tiles Stack) {
+			stack := combined.Get(x, y).Clone()
+			if stack == nil {
+				stack = make(Stack, len(names))
+			}
+			stack[i] = tiles[len(tiles)-1]
+			combined.Put(stack, x, y)
+		})
+	}
+	return combined
+}
+
+// Walkable is true if the cell at x, y has a tile in some layer and none of its tiles in any layer block the way
+func (m *Map) Walkable(x, y int) bool {
+	empty := true
+	for _, l := range m.Layers {
+		for _, t := range l.Tilemap.Get(x, y) {
+			if !m.Tileset.Walkable(t) {
+				return false
+			}
+			empty = false
+		}
+	}
+	return !empty
+}
+
+// combined returns the stack Combine would have at x, y
+func (m *Map) combined(names []string, x, y int) Stack {
+	var stack Stack
+	for i, name := range names {
+		l := m.Layer(name)
+		if l == nil {
+			continue
+		}
+		if tiles := l.Tilemap.Get(x, y); len(tiles) > 0 {
+			if stack == nil {
+				stack = make(Stack, len(names))
+			}
+			stack[i] = tiles[len(tiles)-1]
+		}
+	}
+	return stack
+}
+
+// Split writes a stack produced by Combine back into the named layers at x, y, calling set for each layer
+// whose cell changes
+func (m *Map) Split(names []string, stack Stack, x, y int, set func(l *Layer, before, after Stack)) {
+	for i, name := range names {
+		l := m.Layer(name)
+		if l == nil || l.Locked {
+			continue
+		}
+		var after Stack
+		if i < len(stack) && stack[i] != nil {
+			after = Stack{stack[i]}
+		}
+		before := l.Tilemap.Get(x, y)
+		if before.Hash() == after.Hash() {
+			continue
+		}
+		if set != nil {
+			set(l, before.Clone(), after)
+		}
+		l.Tilemap.Put(after, x, y)
+	}
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveLayer(t *testing.T) {
+	m := NewMap(16, 16, NewTileset())
+	m.AddLayer("walls")
+	m.AddLayer("decor")
+	m.MoveLayer("decor", -2)
+	m.MoveLayer("Layer 1", 5)
+	if got, want := m.LayerNames(), []string{"decor", "walls", "Layer 1"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("wrong layer order, got %v, want %v", got, want)
+	}
+}
+
+func TestGenerateLayers(t *testing.T) {
+	ts := NewTileset()
+	ts.Spritesheets["a"] = &Spritesheet{Name: "a", TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	m := NewMap(16, 16, ts)
+	floor := m.Layer("Layer 1").Tilemap
+	walls := m.AddLayer("walls").Tilemap
+	characters := m.AddLayer("characters").Tilemap
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			floor.Put(Stack{{Spritesheet: "a", Index: 1}}, x, y)
+		}
+		walls.Put(Stack{{Spritesheet: "a", Index: 2}}, x, 0)
+	}
+	characters.Put(Stack{{Spritesheet: "a", Index: 3}}, 1, 1)
+
+	combined := m.Combine([]string{"Layer 1", "walls"})
+	if got, want := combined.Get(0, 0).Hash(), "a:1,a:2"; got != want {
+		t.Fatalf("wrong combined stack, got %q, want %q", got, want)
+	}
+	if got, want := combined.Get(0, 1).Hash(), "a:1,"; got != want {
+		t.Fatalf("wrong combined stack, got %q, want %q", got, want)
+	}
+
+	gen, err := m.NewGeneration([]string{"Layer 1", "walls"}, image.Rectangle{}, image.Rect(0, 4, 4, 8), "wfc", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for !gen.Step(1) {
+	}
+	h := NewHistory(DefaultHistorySize)
+	if err := gen.Apply(m, h); err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 4; x++ {
+		for y := 4; y < 8; y++ {
+			if len(floor.Get(x, y)) != 1 {
+				t.Fatalf("expected floor at %d, %d", x, y)
+			}
+			if len(characters.Get(x, y)) != 0 {
+				t.Fatalf("unexpected character at %d, %d", x, y)
+			}
+		}
+	}
+	h.Undo(m)
+	if got := floor.Bounds(); got != image.Rect(0, 0, 4, 4) {
+		t.Fatalf("wrong floor bounds after undo, got %v", got)
+	}
+}
+
+func TestLoadLegacyMap(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "map.json")
+	legacy := `{"Spritesheets":{"a":{"Name":"a","Size":16,"Width":4,"Height":4}},"TileWidth":16,"TileHeight":16,
+		"Tilemap":{"0":{"0":[{"Spritesheet":"a","Index":1},{"Spritesheet":"a","Index":2}]},"1":{"0":[{"Spritesheet":"a","Index":3}]}}}`
+	if err := os.WriteFile(filename, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewMap(0, 0, nil)
+	if err := m.Load(filename); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(m.Layers), 2; got != want {
+		t.Fatalf("wrong number of layers, got %d, want %d", got, want)
+	}
+	if got, want := m.Combine(nil).Get(0, 0).Hash(), "a:1,a:2"; got != want {
+		t.Fatalf("wrong stack, got %q, want %q", got, want)
+	}
+	if got, want := m.Combine(nil).Get(1, 0).Hash(), "a:3,"; got != want {
+		t.Fatalf("wrong stack, got %q, want %q", got, want)
+	}
+}
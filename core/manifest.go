@@ -0,0 +1,76 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A manifest is a tileset saved on its own, so maps can share it by naming it in Map.Manifest
+// LoadManifest reads the tileset of the manifest filename, loading every spritesheet along with its sidecar files
+func LoadManifest(filename string) (*Tileset, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	ts := NewTileset()
+	if err := json.Unmarshal(buf, ts); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	dir := filepath.Dir(filename)
+	for name, sheet := range ts.Spritesheets {
+		sheet.Name = name
+		sheet.Path = resolvePath(dir, filepath.ToSlash(sheet.File()))
+		if sheet.Path == sheet.Name {
+			sheet.Path = ""
+		}
+		if err := sheet.Load(); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	return ts, nil
+}
+
+// SaveManifest writes ts to the manifest filename, with the images of its spritesheets relative to it
+func (ts *Tileset) SaveManifest(filename string) error {
+	dir := filepath.Dir(filename)
+	manifest := NewTileset()
+	for name, sheet := range ts.Spritesheets {
+		s := *sheet
+		s.Path = filepath.ToSlash(relativePath(dir, sheet.File()))
+		if s.Path == filepath.ToSlash(name) {
+			s.Path = ""
+		}
+		manifest.Spritesheets[name] = &s
+	}
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf, 0644)
+}
+
+// UseManifest replaces the spritesheets of the map with those of the manifest filename, which the map refers to when
+// saved from then on
+func (m *Map) UseManifest(filename string) error {
+	ts, err := LoadManifest(filename)
+	if err != nil {
+		return err
+	}
+	if m.Tileset == nil {
+		m.Tileset = NewTileset()
+	}
+	m.Spritesheets = ts.Spritesheets
+	m.tiles = nil
+	m.manifest = filename
+	return nil
+}
+
+// SaveManifest writes the map's tileset to the manifest it refers to, e.g. after adding a spritesheet
+func (m *Map) SaveManifest() error {
+	if m.manifest == "" {
+		return fmt.Errorf("map has no manifest")
+	}
+	return m.Tileset.SaveManifest(m.manifest)
+}
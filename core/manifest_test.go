@@ -0,0 +1,141 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePNG(t *testing.T, filename string, w, h int) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	// 3x2 tiles of 16x24, 1px apart within a 2px margin on the top left, without spacing after the last
+	writePNG(t, filepath.Join(dir, "art", "trees.png"), 2+3*16+2, 2+2*24+1)
+	manifest := filepath.Join(dir, "art", "tileset.json")
+	if err := os.WriteFile(manifest, []byte(`{"Spritesheets": {
+		"trees": {"Path": "trees.png", "TileWidth": 16, "TileHeight": 24, "Spacing": 1, "Margin": 2, "OffsetY": -8}
+	}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ts, err := LoadManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet := ts.Spritesheets["trees"]
+	if sheet.Width != 3 || sheet.Height != 2 || sheet.Image == nil {
+		t.Fatalf("wrong spritesheet %+v", sheet)
+	}
+	if got, want := *sheet.Rect(4), image.Rect(19, 27, 35, 51); got != want {
+		t.Fatalf("wrong rect, got %v, want %v", got, want)
+	}
+	if got, want := sheet.TileAt(20, 30), 4; got != want {
+		t.Fatalf("wrong tile, got %d, want %d", got, want)
+	}
+	if got := sheet.TileAt(1, 1); got != -1 {
+		t.Fatalf("expected no tile in the margin, got %d", got)
+	}
+
+	m := NewMap(16, 16, NewTileset())
+	if err := m.UseManifest(manifest); err != nil {
+		t.Fatal(err)
+	}
+	m.Layers[0].Tilemap.Put(Stack{{Spritesheet: "trees", Index: 4}}, 1, 1)
+	filename := filepath.Join(dir, "maps", "forest.json")
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Manifest, "../art/tileset.json"; got != want {
+		t.Fatalf("wrong manifest, got %q, want %q", got, want)
+	}
+	if buf, err := os.ReadFile(filename); err != nil || bytes.Contains(buf, []byte("Spritesheets")) {
+		t.Fatalf("expected the spritesheets to be left to the manifest, got %s, %v", buf, err)
+	}
+	m.Spritesheets["trees"].SetSymmetry(4, SymmetryX)
+	if err := m.SaveManifest(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMap(0, 0, nil)
+	if err := loaded.Load(filename); err != nil {
+		t.Fatal(err)
+	}
+	got := loaded.Spritesheets["trees"]
+	if got == nil || got.Image == nil || got.Symmetry(4) != SymmetryX || got.OffsetY != -8 {
+		t.Fatalf("wrong spritesheet from the manifest %+v", got)
+	}
+	if got, want := loaded.Layers[0].Tilemap.Get(1, 1).Hash(), "trees:4"; got != want {
+		t.Fatalf("wrong tile, got %q, want %q", got, want)
+	}
+}
+
+func TestManifestSidecars(t *testing.T) {
+	// the sidecar files of a spritesheet sit beside its image, not its name
+	dir := t.TempDir()
+	writePNG(t, filepath.Join(dir, "img", "trees.png"), 64, 16)
+	for filename, content := range map[string]string{
+		"tileset.json":              `{"Spritesheets": {"forest": {"Path": "img/trees.png", "TileWidth": 16, "TileHeight": 16}}}`,
+		"img/trees.properties.json": `{"3": {"Values": {"walkable": false}}}`,
+		"img/trees.sockets.json":    `{"3": ["road"]}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(filename)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts, err := LoadManifest(filepath.Join(dir, "tileset.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet := ts.Spritesheets["forest"]
+	if sheet.Walkable(3) || !sheet.Walkable(2) {
+		t.Fatalf("wrong properties %+v", sheet.Properties)
+	}
+	if got, want := sheet.Sockets[3][North], "road"; got != want {
+		t.Fatalf("wrong socket, got %q, want %q", got, want)
+	}
+	sheet.SetSocket(2, East, "road")
+	sheet.SetWalkable(2, false)
+	if err := sheet.SaveSockets(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sheet.SaveProperties(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sheet.LoadSockets(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sheet.LoadProperties(); err != nil {
+		t.Fatal(err)
+	}
+	if sheet.Sockets[2][East] != "road" || sheet.Walkable(2) {
+		t.Fatal("expected sidecars to be saved beside the image")
+	}
+}
+
+func TestLegacySpritesheet(t *testing.T) {
+	var sheet Spritesheet
+	if err := json.Unmarshal([]byte(`{"Name": "a.png", "Size": 16, "Spacing": 1, "Width": 2, "Height": 2}`), &sheet); err != nil {
+		t.Fatal(err)
+	}
+	if sheet.TileWidth != 16 || sheet.TileHeight != 16 {
+		t.Fatalf("expected 16x16 tiles, got %dx%d", sheet.TileWidth, sheet.TileHeight)
+	}
+}
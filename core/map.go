@@ -0,0 +1,144 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Map is a stack of named layers along with the tileset they draw from, as saved to map.json
+type Map struct {
+	*Tileset
+	TileWidth, TileHeight int
+	Grid                  Grid       `json:",omitempty"`
+	Projection            Projection `json:",omitempty"`
+	Layers                []*Layer
+	// Manifest is the file of the tileset manifest the map draws from relative to the map, if it has one, see
+	// UseManifest. Its spritesheets are left out of the map when it's saved.
+	Manifest string `json:",omitempty"`
+	// manifest is the manifest file relative to the working directory
+	manifest string
+	// WorldSeed is the seed of the World explored from the map, see NewWorld
+	WorldSeed int64 `json:",omitempty"`
+	// Constraints are followed by the map's generations as well as the rules, see Generation.Constrain
+	Constraints []Constraint `json:",omitempty"`
+	// Generations are the generations applied to the map, in order, see Map.Regenerate
+	Generations []*Record `json:",omitempty"`
+	// Rules are the rules followed by Generations, by their Fingerprint
+	Rules map[string]*Analysis `json:",omitempty"`
+	// Ruleset, if not nil, is followed by NewGeneration instead of learning from the map, see LoadAnalysis
+	Ruleset *Analysis `json:"-"`
+}
+
+// NewMap returns an empty map with a single layer
+func NewMap(tileWidth, tileHeight int, tileset *Tileset) *Map {
+	return &Map{
+		Tileset:    tileset,
+		TileWidth:  tileWidth,
+		TileHeight: tileHeight,
+		Layers:     []*Layer{NewLayer("Layer 1")},
+	}
+}
+
+func (m *Map) Save(filename string) error {
+	m.Cleanup()
+	saved := *m
+	if m.manifest != "" {
+		m.Manifest = filepath.ToSlash(relativePath(filepath.Dir(filename), m.manifest))
+		saved.Manifest, saved.Tileset = m.Manifest, nil
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(&saved); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load decodes the map saved in filename into m, leaving m untouched if the file doesn't exist, along with the
+// tileset of its manifest if it has one. Maps saved before layers existed are migrated by moving each level of
+// their stacks into its own layer.
+func (m *Map) Load(filename string) error {
+	buf, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var legacy struct {
+		Layers  json.RawMessage
+		Tilemap Tilemap
+	}
+	if err := json.Unmarshal(buf, &legacy); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(buf, m); err != nil {
+		return err
+	}
+	if m.Tileset == nil {
+		m.Tileset = NewTileset()
+	}
+	if m.Manifest != "" {
+		if err := m.UseManifest(resolvePath(filepath.Dir(filename), m.Manifest)); err != nil {
+			return err
+		}
+	}
+	if legacy.Layers == nil {
+		m.Layers = nil
+		legacy.Tilemap.Each(func(x, y int, tiles Stack) {
+			for z, tile := range tiles {
+				m.AddLayer(fmt.Sprintf("Layer %d", z+1)).Tilemap.Put(Stack{tile}, x, y)
+			}
+		})
+		m.sortLayers()
+		if len(m.Layers) == 0 {
+			m.AddLayer("Layer 1")
+		}
+	}
+	for _, l := range m.Layers {
+		if l.Tilemap == nil {
+			l.Tilemap = make(Tilemap)
+		}
+	}
+	m.Cleanup()
+	if err := m.Tileset.LoadSockets(); err != nil {
+		return err
+	}
+	return m.Tileset.LoadProperties()
+}
+
+// sortLayers orders migrated layers by their number, as map iteration creates them in any order
+func (m *Map) sortLayers() {
+	layers := make([]*Layer, 0, len(m.Layers))
+	for i := 1; len(layers) < len(m.Layers); i++ {
+		if l := m.Layer(fmt.Sprintf("Layer %d", i)); l != nil {
+			layers = append(layers, l)
+		}
+	}
+	m.Layers = layers
+}
+
+// Cleanup removes unknown tiles from each layer, keeping only the topmost tile of each cell, and any empty
+// cells, along with any rules no generation followed
+func (m *Map) Cleanup() {
+	m.cleanupRules()
+	for _, l := range m.Layers {
+		l.Tilemap.Each(func(x, y int, tiles Stack) {
+			var stack Stack
+			for i := len(tiles) - 1; i >= 0; i-- {
+				tile := tiles[i]
+				if tile != nil && tile.Index >= 0 && m.Spritesheets[tile.Spritesheet] != nil {
+					stack = Stack{tile}
+					break
+				}
+			}
+			if stack.Hash() != tiles.Hash() {
+				l.Tilemap.Put(stack, x, y)
+			}
+		})
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package core
 
 import (
 	"fmt"
@@ -63,3 +63,11 @@ func (a *NDArray[V]) At(coords ...int) V {
 func (a *NDArray[V]) Set(v V, dims ...int) {
 	a.array[a.Index(dims...)] = v
 }
+
+func (a *NDArray[V]) AtIndex(i int) V {
+	return a.array[i]
+}
+
+func (a *NDArray[V]) SetIndex(v V, i int) {
+	a.array[i] = v
+}
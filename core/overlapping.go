@@ -0,0 +1,206 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/constraints"
+)
+
+/*
+Overlapping model: instead of learning which single tiles may sit next to each other, extract every NxN
+pattern from the sample and learn which patterns may overlap when offset by one cell. The patterns become
+the domain of a regular WFC, and each output cell takes the tile at its pattern's origin.
+*/
+type OverlappingOptions struct {
+	// N is the width and height of the extracted patterns
+	N int
+	// Symmetry is the number of rotations and reflections of each pattern to add, from 1 (none) to 8 (all)
+	Symmetry int
+	// Periodic wraps the sample around its edges when extracting patterns
+	Periodic bool
+}
+
+func init() {
+	RegisterAlgorithm(&Algorithm{
+		Name: "overlapping",
+		Params: []Param{
+			{Name: "N", Default: 3, Min: 1, Max: 8},
+			{Name: "symmetry", Default: 1, Min: 1, Max: 8},
+			{Name: "periodic", Default: 0, Min: 0, Max: 1},
+			{Name: "backtracks", Default: DefaultBacktracks, Min: 0, Max: 4096},
+			{Name: "retries", Default: DefaultRetries, Min: 0, Max: 256},
+		},
+		Analyze: func(sample Tilemap, opts Options) *Analysis {
+			return AnalyzeOverlapping(sample, OverlappingOptions{
+				N:        opts["N"],
+				Symmetry: opts["symmetry"],
+				Periodic: opts["periodic"] != 0,
+			})
+		},
+		New: newWFCGenerator,
+	})
+}
+
+type pattern []int
+
+func (p pattern) key() string {
+	a := make([]string, len(p))
+	for i, t := range p {
+		a[i] = fmt.Sprint(t)
+	}
+	return strings.Join(a, ",")
+}
+
+func (p pattern) rotate(n int) pattern {
+	r := make(pattern, len(p))
+	for x := 0; x < n; x++ {
+		for y := 0; y < n; y++ {
+			r[x+y*n] = p[n-1-y+x*n]
+		}
+	}
+	return r
+}
+
+func (p pattern) reflect(n int) pattern {
+	r := make(pattern, len(p))
+	for x := 0; x < n; x++ {
+		for y := 0; y < n; y++ {
+			r[x+y*n] = p[n-1-x+y*n]
+		}
+	}
+	return r
+}
+
+// agrees is true if q can be placed at offset dx, dy from p without any overlapping cells disagreeing
+func (p pattern) agrees(q pattern, dx, dy, n int) bool {
+	xmin, xmax := max(dx, 0), min(dx+n, n)
+	ymin, ymax := max(dy, 0), min(dy+n, n)
+	for x := xmin; x < xmax; x++ {
+		for y := ymin; y < ymax; y++ {
+			if p[x+y*n] != q[x-dx+(y-dy)*n] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func AnalyzeOverlapping(tilemap Tilemap, opts OverlappingOptions) *Analysis {
+	n := opts.N
+	if n < 1 {
+		n = 1
+	}
+	symmetry := opts.Symmetry
+	if symmetry < 1 {
+		symmetry = 1
+	} else if symmetry > 8 {
+		symmetry = 8
+	}
+	bounds := tilemap.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// index each distinct stack in the sample
+	tiles := []Stack{nil}
+	tileIndex := map[string]int{"": 0}
+	sample := NewNDArray[int](max(width, 1), max(height, 1))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			stack := tilemap.Get(x+bounds.Min.X, y+bounds.Min.Y)
+			h := stack.Hash()
+			i, ok := tileIndex[h]
+			if !ok {
+				i = len(tiles)
+				tileIndex[h] = i
+				tiles = append(tiles, stack)
+			}
+			sample.Set(i, x, y)
+		}
+	}
+
+	// extract patterns and their symmetries, counting occurrences
+	var patterns []pattern
+	var counts []float64
+	patternIndex := make(map[string]int)
+	xmax, ymax := width-n+1, height-n+1
+	if opts.Periodic {
+		xmax, ymax = width, height
+	}
+	for y := 0; y < ymax; y++ {
+		for x := 0; x < xmax; x++ {
+			p := make(pattern, n*n)
+			for dx := 0; dx < n; dx++ {
+				for dy := 0; dy < n; dy++ {
+					p[dx+dy*n] = sample.At((x+dx)%width, (y+dy)%height)
+				}
+			}
+			ps := make([]pattern, 8)
+			ps[0] = p
+			ps[1] = ps[0].reflect(n)
+			ps[2] = ps[0].rotate(n)
+			ps[3] = ps[2].reflect(n)
+			ps[4] = ps[2].rotate(n)
+			ps[5] = ps[4].reflect(n)
+			ps[6] = ps[4].rotate(n)
+			ps[7] = ps[6].reflect(n)
+			for _, p := range ps[:symmetry] {
+				k := p.key()
+				if i, ok := patternIndex[k]; ok {
+					counts[i]++
+				} else {
+					patternIndex[k] = len(patterns)
+					patterns = append(patterns, p)
+					counts = append(counts, 1)
+				}
+			}
+		}
+	}
+
+	domain := make([]Stack, len(patterns))
+	domainIndex := make(map[string]int)
+	var sum float64
+	for i, p := range patterns {
+		domain[i] = tiles[p[0]]
+		if _, ok := domainIndex[domain[i].Hash()]; !ok {
+			domainIndex[domain[i].Hash()] = i
+		}
+		sum += counts[i]
+	}
+	probs := make([]float64, len(patterns))
+	for i, count := range counts {
+		probs[i] = count / sum
+	}
+	adj := NewNDArray[map[int]bool](len(patterns), NumDirections)
+	for i, p := range patterns {
+		for _, d := range GridSquare.Directions() {
+			o := Neighbors[d]
+			a := make(map[int]bool)
+			for j, q := range patterns {
+				if p.agrees(q, o[0], o[1], n) {
+					a[j] = true
+				}
+			}
+			adj.Set(a, i, int(d))
+		}
+	}
+	return &Analysis{
+		Domain:        domain,
+		DomainIndex:   domainIndex,
+		Probabilities: probs,
+		Adj:           adj,
+	}
+}
+
+func min[T constraints.Ordered](a, b T) T {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max[T constraints.Ordered](a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
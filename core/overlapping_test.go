@@ -0,0 +1,60 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPatternSymmetry(t *testing.T) {
+	p := pattern{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if got, want := p.rotate(3), (pattern{3, 6, 9, 2, 5, 8, 1, 4, 7}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong rotation, got %v, want %v", got, want)
+	}
+	if got, want := p.reflect(3), (pattern{3, 2, 1, 6, 5, 4, 9, 8, 7}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong reflection, got %v, want %v", got, want)
+	}
+	if got := p.rotate(3).rotate(3).rotate(3).rotate(3); !reflect.DeepEqual(got, p) {
+		t.Fatalf("four rotations should be the identity, got %v", got)
+	}
+}
+
+func TestOverlapping(t *testing.T) {
+	m := make(Tilemap)
+	a, b := &Tile{Spritesheet: "a", Index: 1}, &Tile{Spritesheet: "b", Index: 2}
+	/*
+		abab
+		baba
+		abab
+		baba
+	*/
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			if (x+y)%2 == 0 {
+				m.Set(a, x, y, false, 0)
+			} else {
+				m.Set(b, x, y, false, 0)
+			}
+		}
+	}
+	analysis := AnalyzeOverlapping(m, OverlappingOptions{N: 2, Symmetry: 1, Periodic: true})
+	if got, want := len(analysis.Domain), 2; got != want {
+		t.Fatalf("wrong number of patterns, got %d, want %d", got, want)
+	}
+	g := NewWFC(analysis, 6, 6, nil, 1)
+	for !g.Done() {
+	}
+	result := g.Result()
+	for x := 0; x < len(result); x++ {
+		for y := 0; y < len(result[x]); y++ {
+			if result[x][y] == nil {
+				t.Fatalf("missing tile at %d, %d", x, y)
+			}
+			if x > 0 && result[x][y].Hash() == result[x-1][y].Hash() {
+				t.Fatalf("tile at %d, %d matches its west neighbor", x, y)
+			}
+			if y > 0 && result[x][y].Hash() == result[x][y-1].Hash() {
+				t.Fatalf("tile at %d, %d matches its north neighbor", x, y)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+/*
+Projection is how a map is viewed. Its grid is laid out top down as usual, and the projection maps those pixels
+onto the screen. The isometric projections turn the map 45 degrees and squash it vertically so each square cell
+becomes a diamond as wide as a tile. Tiles of flat layers are projected along with the map, while tiles of upright
+layers, like walls and trees, stand up at their cell as they are drawn in the spritesheet.
+*/
+type Projection uint8
+
+const (
+	// ProjectionTopDown draws the map as laid out
+	ProjectionTopDown = Projection(iota)
+	// ProjectionIsometric is a true isometric view, the diamonds are 1/√3 as tall as they are wide
+	ProjectionIsometric
+	// ProjectionDimetric is the pixel art "isometric" view, the diamonds are half as tall as they are wide
+	ProjectionDimetric
+)
+
+var projectionNames = []string{"top-down", "isometric", "dimetric"}
+
+// Projections lists every projection in the order the editor cycles through them
+var Projections = []Projection{ProjectionTopDown, ProjectionIsometric, ProjectionDimetric}
+
+func (p Projection) String() string {
+	if int(p) < len(projectionNames) {
+		return projectionNames[p]
+	}
+	return fmt.Sprintf("Projection(%d)", p)
+}
+
+func (p Projection) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Projection) UnmarshalText(text []byte) error {
+	for i, name := range projectionNames {
+		if string(text) == name {
+			*p = Projection(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown projection %q", text)
+}
+
+// Matrix returns the linear transform from top down pixels to projected ones, px' = a*px + b*py, py' = c*px + d*py
+func (p Projection) Matrix(tileWidth, tileHeight float64) (a, b, c, d float64) {
+	var ratio float64
+	switch p {
+	case ProjectionIsometric:
+		ratio = 1 / math.Sqrt(3)
+	case ProjectionDimetric:
+		ratio = 0.5
+	default:
+		return 1, 0, 0, 1
+	}
+	// a cell's x axis runs half a tile right and its y axis half a tile left, both going down by the ratio
+	s := tileWidth / tileHeight
+	return 0.5, -0.5 * s, 0.5 * ratio, 0.5 * ratio * s
+}
+
+// Project returns where the top down pixel px, py is drawn
+func (p Projection) Project(px, py, tileWidth, tileHeight float64) (float64, float64) {
+	a, b, c, d := p.Matrix(tileWidth, tileHeight)
+	return a*px + b*py, c*px + d*py
+}
+
+// Unproject returns the top down pixel drawn at px, py, the inverse of Project
+func (p Projection) Unproject(px, py, tileWidth, tileHeight float64) (float64, float64) {
+	a, b, c, d := p.Matrix(tileWidth, tileHeight)
+	det := a*d - b*c
+	return (d*px - b*py) / det, (a*py - c*px) / det
+}
+
+// Sprite is something drawn standing up at a cell of a projected map, like an upright tile or a character
+type Sprite struct {
+	X, Y int
+	// OffsetX and OffsetY move the sprite away from its cell in top down pixels, e.g. while walking to the next one
+	OffsetX, OffsetY float64
+	// Layer is the index of the sprite's layer, sprites above every layer use len(Layers)
+	Layer int
+	Tile  *Tile
+}
+
+// DepthSort orders sprites back to front on the map's grid and projection. Sprites further down the screen are
+// drawn over those behind them, and sprites at the same depth are drawn in layer order, then from left to right,
+// and then in the order given, which keeps each stack in order.
+func (m *Map) DepthSort(sprites []Sprite) {
+	w, h := float64(m.TileWidth), float64(m.TileHeight)
+	depth := func(s Sprite) float64 {
+		px, py := m.Grid.Position(s.X, s.Y, w, h)
+		_, d := m.Projection.Project(px+w/2+s.OffsetX, py+h/2+s.OffsetY, w, h)
+		return d
+	}
+	sort.SliceStable(sprites, func(i, j int) bool {
+		di, dj := depth(sprites[i]), depth(sprites[j])
+		// cells on the same diagonal should tie, despite rounding
+		if math.Abs(di-dj) > 1e-9 {
+			return di < dj
+		}
+		if sprites[i].Layer != sprites[j].Layer {
+			return sprites[i].Layer < sprites[j].Layer
+		}
+		return sprites[i].X < sprites[j].X
+	})
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestProjectionRoundTrip(t *testing.T) {
+	for _, p := range Projections {
+		for _, pt := range [][2]float64{{0, 0}, {16, 0}, {0, 16}, {-40, 72}, {123.5, -7.25}} {
+			px, py := p.Project(pt[0], pt[1], 16, 24)
+			ux, uy := p.Unproject(px, py, 16, 24)
+			if math.Abs(ux-pt[0]) > 1e-9 || math.Abs(uy-pt[1]) > 1e-9 {
+				t.Fatalf("%s: %v projects to %g, %g which unprojects to %g, %g", p, pt, px, py, ux, uy)
+			}
+		}
+	}
+	// a dimetric cell is a diamond as wide as a tile and half as tall
+	x0, y0 := ProjectionDimetric.Project(0, 0, 16, 16)
+	x1, y1 := ProjectionDimetric.Project(16, 0, 16, 16)
+	x2, y2 := ProjectionDimetric.Project(0, 16, 16, 16)
+	if x1-x2 != 16 || y1-y0 != 4 || y2-y0 != 4 {
+		t.Fatalf("wrong dimetric diamond, got %g, %g, %g, %g, %g, %g", x0, y0, x1, y1, x2, y2)
+	}
+}
+
+func TestDepthSort(t *testing.T) {
+	m := NewMap(16, 16, nil)
+	m.Projection = ProjectionIsometric
+	sprites := []Sprite{
+		{X: 2, Y: 0, Layer: 1, Tile: &Tile{Spritesheet: "a", Index: 4}},
+		{X: 1, Y: 1, Layer: 1, Tile: &Tile{Spritesheet: "a", Index: 1}},
+		{X: 1, Y: 1, Layer: 1, Tile: &Tile{Spritesheet: "a", Index: 2}},
+		{X: 0, Y: 2, Layer: 2, Tile: &Tile{Spritesheet: "b"}},
+		{X: 0, Y: 0, Layer: 1, Tile: &Tile{Spritesheet: "a", Index: 3}},
+	}
+	m.DepthSort(sprites)
+	var got []string
+	for _, s := range sprites {
+		got = append(got, s.Tile.Hash())
+	}
+	// the character ties with the walls on its diagonal but is above every layer, and each stack stays in order
+	want := []string{"a:3", "a:1", "a:2", "a:4", "b:0"}
+	if len(got) != len(want) {
+		t.Fatalf("wrong sprites, got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("wrong order, got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSaveProjection(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "map.json")
+	m := NewMap(16, 16, NewTileset())
+	m.Projection = ProjectionDimetric
+	m.AddLayer("walls").Upright = true
+	if err := m.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMap(0, 0, NewTileset())
+	if err := loaded.Load(filename); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Projection != ProjectionDimetric {
+		t.Fatalf("wrong projection, got %s", loaded.Projection)
+	}
+	if loaded.Layer("walls") == nil || !loaded.Layer("walls").Upright || loaded.Layer("Layer 1").Upright {
+		t.Fatalf("wrong upright layers after loading")
+	}
+}
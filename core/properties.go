@@ -0,0 +1,253 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Properties are the metadata of a single tile of a spritesheet: tags, and values by key, each a bool, a number or a
+string. They're kept in a sidecar file beside the spritesheet image, see PropertiesFilename, so every map using the
+image shares them.
+
+Some keys mean something to weave itself:
+
+	walkable  bool, false if the tile blocks the way in Explore, see Map.Walkable
+	weight    number, scales how likely generators are to place the tile, see Analysis.Weigh
+*/
+type Properties struct {
+	Tags   []string               `json:",omitempty"`
+	Values map[string]interface{} `json:",omitempty"`
+}
+
+// Empty is true if p has neither tags nor values
+func (p *Properties) Empty() bool {
+	return p == nil || (len(p.Tags) == 0 && len(p.Values) == 0)
+}
+
+// HasTag is true if p is tagged tag
+func (p *Properties) HasTag(tag string) bool {
+	if p == nil {
+		return false
+	}
+	for _, t := range p.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTags replaces the tags of p, dropping duplicates and blanks and keeping them sorted
+func (p *Properties) SetTags(tags []string) {
+	seen := make(map[string]bool)
+	p.Tags = nil
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t != "" && !seen[t] {
+			seen[t] = true
+			p.Tags = append(p.Tags, t)
+		}
+	}
+	sort.Strings(p.Tags)
+}
+
+// Bool is the value of key, or def if it isn't a bool
+func (p *Properties) Bool(key string, def bool) bool {
+	if p == nil {
+		return def
+	}
+	if v, ok := p.Values[key].(bool); ok {
+		return v
+	}
+	return def
+}
+
+// Number is the value of key, or def if it isn't a number
+func (p *Properties) Number(key string, def float64) float64 {
+	if p == nil {
+		return def
+	}
+	if v, ok := p.Values[key].(float64); ok {
+		return v
+	}
+	return def
+}
+
+// String is the value of key, or def if it isn't a string
+func (p *Properties) String(key string, def string) string {
+	if p == nil {
+		return def
+	}
+	if v, ok := p.Values[key].(string); ok {
+		return v
+	}
+	return def
+}
+
+// Set sets key to value, which must be a bool, a number or a string, removing it if value is nil
+func (p *Properties) Set(key string, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		delete(p.Values, key)
+		return
+	case int:
+		value = float64(v)
+	case bool, float64, string:
+	default:
+		panic("core: property " + key + " must be a bool, a number or a string")
+	}
+	if p.Values == nil {
+		p.Values = make(map[string]interface{})
+	}
+	p.Values[key] = value
+}
+
+// Keys are the keys of the values of p, sorted
+func (p *Properties) Keys() []string {
+	if p == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(p.Values))
+	for k := range p.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseValue is the property value written as s: true or false, a number, otherwise a string, or nil if s is blank
+func ParseValue(s string) interface{} {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// FormatValue writes a property value the way ParseValue reads it
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// PropertiesFilename is the sidecar file holding the tile properties of the spritesheet image filename
+func PropertiesFilename(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + ".properties.json"
+}
+
+// LoadProperties reads the sidecar properties file of the spritesheet, if there is one
+func (s *Spritesheet) LoadProperties() error {
+	buf, err := os.ReadFile(PropertiesFilename(s.File()))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, &s.Properties)
+}
+
+// SaveProperties writes the sidecar properties file of the spritesheet
+func (s *Spritesheet) SaveProperties() error {
+	s.cleanupProperties()
+	buf, err := json.MarshalIndent(s.Properties, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(PropertiesFilename(s.File()), buf, 0644)
+}
+
+// TileProperties are the properties of the tile at index, nil if it has none
+func (s *Spritesheet) TileProperties(index int) *Properties {
+	if s == nil {
+		return nil
+	}
+	return s.Properties[index]
+}
+
+// EditProperties are the properties of the tile at index, added if it has none yet
+func (s *Spritesheet) EditProperties(index int) *Properties {
+	p := s.Properties[index]
+	if p == nil {
+		p = new(Properties)
+		if s.Properties == nil {
+			s.Properties = make(map[int]*Properties)
+		}
+		s.Properties[index] = p
+	}
+	return p
+}
+
+// cleanupProperties drops the properties of tiles that have none left
+func (s *Spritesheet) cleanupProperties() {
+	for i, p := range s.Properties {
+		if p.Empty() {
+			delete(s.Properties, i)
+		}
+	}
+}
+
+// LoadProperties reads the sidecar properties file of every spritesheet
+func (ts *Tileset) LoadProperties() error {
+	for _, sheet := range ts.Spritesheets {
+		if err := sheet.LoadProperties(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Properties are the properties of t, nil if it has none or isn't in the tileset
+func (ts *Tileset) Properties(t *Tile) *Properties {
+	if ts == nil || t == nil {
+		return nil
+	}
+	return ts.Spritesheets[t.Spritesheet].TileProperties(t.Index)
+}
+
+// HasTag is true if t is tagged tag
+func (ts *Tileset) HasTag(t *Tile, tag string) bool {
+	return ts.Properties(t).HasTag(tag)
+}
+
+// Weigh returns a with the probability of every entry of its domain scaled by the "weight" property of each of its
+// tiles, then normalized again. A weight of 0 is never placed unless nothing else fits.
+func (a *Analysis) Weigh(tileset *Tileset) *Analysis {
+	probs := make([]float64, len(a.Probabilities))
+	var sum float64
+	for i, p := range a.Probabilities {
+		for _, t := range a.Domain[i] {
+			p *= tileset.Properties(t).Number("weight", 1)
+		}
+		probs[i] = p
+		sum += p
+	}
+	if sum == 0 {
+		return a
+	}
+	for i := range probs {
+		probs[i] /= sum
+	}
+	weighed := *a
+	weighed.Probabilities = probs
+	return &weighed
+}
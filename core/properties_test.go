@@ -0,0 +1,98 @@
+package core
+
+import (
+	"image"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProperties(t *testing.T) {
+	sheet := &Spritesheet{Name: filepath.Join(t.TempDir(), "dungeon.png"), TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	sheet.EditProperties(1).SetTags([]string{"wall", " stone", "wall", ""})
+	sheet.EditProperties(1).Set("walkable", false)
+	sheet.EditProperties(2).Set("weight", 3)
+	sheet.EditProperties(2).Set("name", "chest")
+	sheet.EditProperties(3).SetTags(nil)
+	if err := sheet.SaveProperties(); err != nil {
+		t.Fatal(err)
+	}
+	want := sheet.Properties
+	sheet.Properties = nil
+	if err := sheet.LoadProperties(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sheet.Properties, want) {
+		t.Fatalf("wrong properties after loading, got %+v, want %+v", sheet.Properties, want)
+	}
+	if _, ok := sheet.Properties[3]; ok {
+		t.Fatal("expected a tile without properties not to be saved")
+	}
+	if got, want := sheet.TileProperties(1).Tags, []string{"stone", "wall"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong tags, got %v, want %v", got, want)
+	}
+	if sheet.Walkable(1) || !sheet.Walkable(2) {
+		t.Fatal("expected only tile 1 to block the way")
+	}
+	p := sheet.TileProperties(2)
+	if p.Number("weight", 1) != 3 || p.String("name", "") != "chest" || p.Bool("name", true) != true {
+		t.Fatalf("wrong values %v", p.Values)
+	}
+	for s, want := range map[string]interface{}{"": nil, "true": true, "1.5": 1.5, "chest": "chest"} {
+		if got := ParseValue(s); got != want {
+			t.Fatalf("wrong value of %q, got %v, want %v", s, got, want)
+		}
+		if want != nil && FormatValue(want) != s {
+			t.Fatalf("wrong format of %v, got %q, want %q", want, FormatValue(want), s)
+		}
+	}
+}
+
+func TestWeigh(t *testing.T) {
+	ts := NewTileset()
+	ts.Spritesheets["a"] = &Spritesheet{Name: "a", TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	ts.Spritesheets["a"].EditProperties(1).Set("weight", 0)
+	ts.Spritesheets["a"].EditProperties(2).Set("weight", 3)
+	// a checkerboard of 0 and 2 with a single 1, which nothing requires
+	sample := make(Tilemap)
+	for y, row := range []string{"0202", "2020", "0212", "2020"} {
+		for x, c := range row {
+			sample.Put(Stack{{Spritesheet: "a", Index: int(c - '0')}}, x, y)
+		}
+	}
+	a := Analyze(sample, GridSquare).Weigh(ts)
+	p := func(i int) float64 {
+		return a.Probabilities[a.DomainIndex[Stack{{Spritesheet: "a", Index: i}}.Hash()]]
+	}
+	if p(1) != 0 || math.Abs(p(2)-3*p(0)*8/7) > 1e-9 || math.Abs(p(0)+p(2)-1) > 1e-9 {
+		t.Fatalf("wrong probabilities %v", a.Probabilities)
+	}
+
+	gen, err := NewGeneration(sample, nil, GridSquare, ts, image.Rect(0, 0, 8, 8), "wfc", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for !gen.Step(1) {
+	}
+	if gen.Err != nil {
+		t.Fatal(gen.Err)
+	}
+	for _, col := range gen.Result() {
+		for _, stack := range col {
+			if stack.Hash() == "a:1" {
+				t.Fatal("expected a tile weighed 0 not to be placed")
+			}
+		}
+	}
+}
+
+func TestConstrainTags(t *testing.T) {
+	ts := NewTileset()
+	ts.Spritesheets["a"] = &Spritesheet{Name: "a", TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	ts.Spritesheets["a"].EditProperties(1).SetTags([]string{"wall"})
+	c := Constraint{Kind: ConstraintBorder, Tiles: []string{"#wall", "a:3", "#missing"}}.tagged(ts)
+	if got, want := c.Tiles, []string{"a:1", "a:3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong tiles, got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"image"
+)
+
+// Record is what a Generation was started from, saved with the map so the same region can be generated again
+type Record struct {
+	Rect      image.Rectangle
+	Layers    []string
+	Algorithm string
+	Options   Options
+	Seed      int64
+	// Fixed are the tiles that were kept in place, by their position on the map
+	Fixed Tilemap `json:",omitempty"`
+	// Rules is the Fingerprint of the rules that were followed, a key of Map.Rules
+	Rules       string
+	Constraints []Constraint `json:",omitempty"`
+}
+
+// Fingerprint identifies the rules of a, two analyses with the same fingerprint generate the same tiles from the
+// same seed
+func (a *Analysis) Fingerprint() string {
+	buf, err := json.Marshal(a)
+	if err != nil {
+		panic(err)
+	}
+	h := fnv.New64a()
+	h.Write(buf)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// Record returns what gen was started from
+func (gen *Generation) Record() *Record {
+	return &Record{
+		Rect:        gen.Rect,
+		Layers:      gen.Layers,
+		Algorithm:   gen.Algorithm,
+		Options:     gen.Options,
+		Seed:        gen.Seed,
+		Fixed:       gen.fixed,
+		Rules:       gen.analysis.Fingerprint(),
+		Constraints: gen.Constraints,
+	}
+}
+
+// Reseed starts generating the same region as gen, from the same rules and fixed tiles, with another seed
+func (gen *Generation) Reseed(seed int64) (*Generation, error) {
+	again, err := NewRulesetGeneration(gen.analysis, gen.fixed, gen.tileset, gen.Rect, gen.Algorithm, gen.Options, seed)
+	if err != nil {
+		return nil, err
+	}
+	if err := again.Constrain(gen.Constraints); err != nil {
+		return nil, err
+	}
+	again.Layers = gen.Layers
+	return again, nil
+}
+
+// record adds the generation to the map's Generations, along with a copy of its rules if they aren't already in
+// Rules, as the rules of a map's Ruleset can be edited afterwards
+func (m *Map) record(gen *Generation) error {
+	r := gen.Record()
+	if m.Rules[r.Rules] == nil {
+		buf, err := json.Marshal(gen.analysis)
+		if err != nil {
+			return err
+		}
+		rules := new(Analysis)
+		if err := json.Unmarshal(buf, rules); err != nil {
+			return err
+		}
+		if m.Rules == nil {
+			m.Rules = make(map[string]*Analysis)
+		}
+		m.Rules[r.Rules] = rules
+	}
+	m.Generations = append(m.Generations, r)
+	return nil
+}
+
+// Regenerate starts generating the region of r again, following the rules and keeping the tiles it was first
+// generated with, from seed. Given r's seed the generation has the same result it had the first time.
+func (m *Map) Regenerate(r *Record, seed int64) (*Generation, error) {
+	rules := m.Rules[r.Rules]
+	if rules == nil {
+		return nil, fmt.Errorf("rules %s of the generation of %v are missing", r.Rules, r.Rect)
+	}
+	gen, err := NewRulesetGeneration(rules, r.Fixed, m.Tileset, r.Rect, r.Algorithm, r.Options, seed)
+	if err != nil {
+		return nil, err
+	}
+	if err := gen.Constrain(r.Constraints); err != nil {
+		return nil, err
+	}
+	gen.Layers = r.Layers
+	return gen, nil
+}
+
+// cleanupRules drops any rules no longer followed by one of the map's Generations
+func (m *Map) cleanupRules() {
+	used := make(map[string]bool)
+	for _, r := range m.Generations {
+		used[r.Rules] = true
+	}
+	for k := range m.Rules {
+		if !used[k] {
+			delete(m.Rules, k)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegenerate(t *testing.T) {
+	ts := NewTileset()
+	ts.Spritesheets["a"] = &Spritesheet{Name: "a", TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	m := NewMap(16, 16, ts)
+	for y, row := range []string{"001122", "011221", "112210", "122100", "221001", "210011"} {
+		for x, c := range row {
+			m.Layers[0].Tilemap.Put(Stack{{Spritesheet: "a", Index: int(c - '0')}}, x, y)
+		}
+	}
+	generate := func(gen *Generation) [][]Stack {
+		for !gen.Step(1) {
+		}
+		if gen.Err != nil {
+			t.Fatal(gen.Err)
+		}
+		return gen.Result()
+	}
+	same := func(a, b [][]Stack) bool {
+		for x := range a {
+			for y := range a[x] {
+				if a[x][y].Hash() != b[x][y].Hash() {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	for i, alg := range AlgorithmNames() {
+		rect := image.Rect(0, 6+8*i, 8, 14+8*i)
+		m.Layers[0].Tilemap.Put(Stack{{Spritesheet: "a", Index: 1}}, 3, rect.Min.Y+3)
+		// every generation learns the rules again
+		var results [][][]Stack
+		var gen *Generation
+		for run := 0; run < 4; run++ {
+			var err error
+			gen, err = m.NewGeneration(nil, rect, rect, alg, nil, 42)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results = append(results, generate(gen))
+		}
+		for _, r := range results[1:] {
+			if !same(results[0], r) {
+				t.Fatalf("%s: the same seed generated different tiles", alg)
+			}
+		}
+		if err := gen.Apply(m, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "map.json")
+	if err := m.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMap(0, 0, ts)
+	if err := loaded.Load(filename); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(loaded.Generations), len(AlgorithmNames()); got != want {
+		t.Fatalf("wrong number of generations, got %d, want %d", got, want)
+	}
+	for _, r := range loaded.Generations {
+		if got, want := r.Fixed.Get(3, r.Rect.Min.Y+3).Hash(), "a:1"; got != want {
+			t.Fatalf("%s: wrong fixed tile, got %q, want %q", r.Algorithm, got, want)
+		}
+		gen, err := loaded.Regenerate(r, r.Seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := generate(gen)
+		for x := range result {
+			for y := range result[x] {
+				if got, want := result[x][y].Hash(), loaded.Combine(r.Layers).Get(x+r.Rect.Min.X, y+r.Rect.Min.Y).Hash(); got != want {
+					t.Fatalf("%s: regenerated %q at %d, %d, want %q", r.Algorithm, got, x, y, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Render draws the cells of tilemap within rect in software, one tileWidth x tileHeight cell per tile
+func Render(tilemap Tilemap, tileset *Tileset, rect image.Rectangle, tileWidth, tileHeight int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx()*tileWidth, rect.Dy()*tileHeight))
+	renderTilemap(dst, tilemap, tileset, GridSquare, rect, tileWidth, tileHeight, nil)
+	return dst
+}
+
+// Render draws the visible layers of m within rect in software, from the bottom up, laid out on the map's grid, along
+// with whatever tiles larger than a cell overdraw past its edges
+func (m *Map) Render(rect image.Rectangle) *image.RGBA {
+	bounds := m.Grid.Bounds(rect, m.TileWidth, m.TileHeight)
+	overdraw := m.Overdraw(m.TileWidth, m.TileHeight)
+	bounds = image.Rectangle{Min: bounds.Min.Add(overdraw.Min), Max: bounds.Max.Add(overdraw.Max)}
+	dst := image.NewRGBA(bounds)
+	for _, l := range m.Layers {
+		if !l.Visible {
+			continue
+		}
+		var mask image.Image
+		if l.Opacity < 1 {
+			mask = image.NewUniform(color.Alpha{uint8(max(l.Opacity, 0) * 255)})
+		}
+		renderTilemap(dst, l.Tilemap, m.Tileset, m.Grid, rect, m.TileWidth, m.TileHeight, mask)
+	}
+	// hex grids may draw rect.Min away from the corner
+	dst.Rect = dst.Rect.Sub(bounds.Min)
+	return dst
+}
+
+// renderTilemap draws tilemap over dst with rect.Min at the origin, row by row so that overlapping hexes and tiles
+// larger than a cell further down are drawn on top, with its opacity scaled by mask if it is not nil. Within a row
+// the oversized tiles are drawn after the rest, so they overdraw their neighbors on any level.
+func renderTilemap(dst draw.Image, tilemap Tilemap, tileset *Tileset, grid Grid, rect image.Rectangle, tileWidth, tileHeight int, mask image.Image) {
+	w, h := float64(tileWidth), float64(tileHeight)
+	ox, oy := grid.Position(rect.Min.X, rect.Min.Y, w, h)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for _, oversized := range []bool{false, true} {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				for _, tile := range tilemap.Get(x, y) {
+					if tile == nil || tileset.Oversized(tile, tileWidth, tileHeight) != oversized {
+						continue
+					}
+					src := tileset.SubImage(tile)
+					if src == nil {
+						continue
+					}
+					if tile.Flip != 0 {
+						src = flip(src, tile.Flip)
+					}
+					b := src.Bounds()
+					px, py := grid.Position(x, y, w, h)
+					p := image.Pt(int(math.Round(px-ox)), int(math.Round(py-oy))).Add(tileset.Anchor(tile, tileWidth, tileHeight))
+					draw.DrawMask(dst, image.Rectangle{Min: p, Max: p.Add(b.Size())}, src, b.Min, mask, image.Point{}, draw.Over)
+				}
+			}
+		}
+	}
+}
+
+func flip(src image.Image, f Flip) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if f&FlipDiagonal != 0 {
+		w, h = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < b.Dx(); x++ {
+		for y := 0; y < b.Dy(); y++ {
+			dx, dy := f.Transform(x, y, b.Dx(), b.Dy())
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
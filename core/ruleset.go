@@ -0,0 +1,192 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"sort"
+)
+
+/*
+A ruleset is an Analysis saved to a file, so the rules learned from one map can be reviewed, edited by hand, merged
+with those of other maps and used to generate any map sharing its tileset.
+*/
+
+// RulesetVersion is the version of the ruleset file format written by Analysis.Save, version 1 predates grids
+// and only has square ones
+const RulesetVersion = 2
+
+type ruleset struct {
+	Version       int
+	Grid          Grid `json:",omitempty"`
+	Domain        []Stack
+	Probabilities []float64
+	// Adjacency[i][d] are the domain entries allowed next to entry i in Direction d
+	Adjacency [][][]int
+	// Footprints[i][z] are the cells covered by level z of entry i, when some of its tiles are larger than a cell
+	Footprints [][]image.Rectangle `json:",omitempty"`
+}
+
+func (a *Analysis) MarshalJSON() ([]byte, error) {
+	r := ruleset{
+		Version:       RulesetVersion,
+		Grid:          a.Grid,
+		Domain:        a.Domain,
+		Probabilities: a.Probabilities,
+		Adjacency:     make([][][]int, len(a.Domain)),
+		Footprints:    a.Footprints,
+	}
+	for i := range a.Domain {
+		r.Adjacency[i] = make([][]int, NumDirections)
+		for _, d := range a.Grid.Directions() {
+			r.Adjacency[i][d] = a.Neighbors(i, d)
+		}
+	}
+	return json.Marshal(r)
+}
+
+func (a *Analysis) UnmarshalJSON(buf []byte) error {
+	var r ruleset
+	if err := json.Unmarshal(buf, &r); err != nil {
+		return err
+	}
+	if r.Version < 1 || r.Version > RulesetVersion {
+		return fmt.Errorf("unsupported ruleset version %d", r.Version)
+	}
+	if len(r.Probabilities) != len(r.Domain) || len(r.Adjacency) != len(r.Domain) {
+		return fmt.Errorf("ruleset has %d domain entries but %d probabilities and %d adjacencies",
+			len(r.Domain), len(r.Probabilities), len(r.Adjacency))
+	}
+	if r.Footprints != nil && len(r.Footprints) != len(r.Domain) {
+		return fmt.Errorf("ruleset has %d domain entries but %d footprints", len(r.Domain), len(r.Footprints))
+	}
+	*a = Analysis{
+		Grid:          r.Grid,
+		Domain:        r.Domain,
+		DomainIndex:   make(map[string]int),
+		Probabilities: r.Probabilities,
+		Adj:           NewNDArray[map[int]bool](len(r.Domain), NumDirections),
+		Footprints:    r.Footprints,
+	}
+	for i, stack := range r.Domain {
+		// the overlapping model has several patterns per stack, index the first like AnalyzeOverlapping
+		if _, ok := a.DomainIndex[stack.Hash()]; !ok {
+			a.DomainIndex[stack.Hash()] = i
+		}
+		if len(r.Adjacency[i]) > NumDirections {
+			return fmt.Errorf("ruleset entry %d has %d directions", i, len(r.Adjacency[i]))
+		}
+		for d, ns := range r.Adjacency[i] {
+			for _, n := range ns {
+				if n < 0 || n >= len(r.Domain) {
+					return fmt.Errorf("ruleset entry %d has neighbor %d out of range", i, n)
+				}
+				a.allow(i, d, n, true)
+			}
+		}
+	}
+	return nil
+}
+
+// Save writes the analysis to a ruleset file
+func (a *Analysis) Save(filename string) error {
+	buf, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf, 0644)
+}
+
+// LoadAnalysis reads a ruleset file written by Analysis.Save
+func LoadAnalysis(filename string) (*Analysis, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	a := new(Analysis)
+	if err := json.Unmarshal(buf, a); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return a, nil
+}
+
+// Neighbors returns the domain entries allowed next to entry i in direction d, in order
+func (a *Analysis) Neighbors(i int, d Direction) []int {
+	var ns []int
+	for n, ok := range a.Adj.At(i, int(d)) {
+		if ok {
+			ns = append(ns, n)
+		}
+	}
+	sort.Ints(ns)
+	return ns
+}
+
+// Allowed is true if entry n may be next to entry i in direction d
+func (a *Analysis) Allowed(i int, d Direction, n int) bool {
+	return a.Adj.At(i, int(d))[n]
+}
+
+// Allow adds or removes n as a neighbor of i in direction d, along with i as the neighbor of n in the inverse
+// direction so the rules stay symmetric
+func (a *Analysis) Allow(i int, d Direction, n int, allowed bool) {
+	a.allow(i, int(d), n, allowed)
+	a.allow(n, int(d.Inverse()), i, allowed)
+}
+
+func (a *Analysis) allow(i, d, n int, allowed bool) {
+	s := a.Adj.At(i, d)
+	if !allowed {
+		delete(s, n)
+		return
+	}
+	if s == nil {
+		s = make(map[int]bool)
+		a.Adj.Set(s, i, d)
+	}
+	s[n] = true
+}
+
+// Merge returns the union of the domains and adjacencies of a and others, e.g. rules learned from several maps,
+// averaging their probabilities. Entries are matched by the hash of their stack, so analyses of the overlapping
+// model can't be merged, and all of them should be on the same grid as a.
+func (a *Analysis) Merge(others ...*Analysis) *Analysis {
+	analyses := append([]*Analysis{a}, others...)
+	domainIndex := map[string]int{
+		"": 0,
+	}
+	domain := []Stack{nil}
+	index := make([][]int, len(analyses))
+	for k, analysis := range analyses {
+		index[k] = make([]int, len(analysis.Domain))
+		for i, stack := range analysis.Domain {
+			h := stack.Hash()
+			j, ok := domainIndex[h]
+			if !ok {
+				j = len(domain)
+				domainIndex[h] = j
+				domain = append(domain, stack)
+			}
+			index[k][i] = j
+		}
+	}
+	merged := &Analysis{
+		Grid:          a.Grid,
+		Domain:        domain,
+		DomainIndex:   domainIndex,
+		Probabilities: make([]float64, len(domain)),
+		Adj:           NewNDArray[map[int]bool](len(domain), NumDirections),
+	}
+	for k, analysis := range analyses {
+		for i := range analysis.Domain {
+			merged.Probabilities[index[k][i]] += analysis.Probabilities[i] / float64(len(analyses))
+			for d := 0; d < NumDirections; d++ {
+				for n := range analysis.Adj.At(i, d) {
+					merged.allow(index[k][i], d, index[k][n], true)
+				}
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRulesetRoundTrip(t *testing.T) {
+	m := make(Tilemap)
+	for x := 0; x < 4; x++ {
+		m.Put(Stack{{Spritesheet: "a", Index: x % 2}}, x, 0)
+		m.Put(Stack{{Spritesheet: "a", Index: 2, Flip: FlipVertical}}, x, 1)
+	}
+	a := Analyze(m, GridSquare)
+	filename := filepath.Join(t.TempDir(), "rules.json")
+	if err := a.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	b, err := LoadAnalysis(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Domain) != len(a.Domain) {
+		t.Fatalf("wrong domain size, got %d, want %d", len(b.Domain), len(a.Domain))
+	}
+	for i, stack := range a.Domain {
+		if got, want := b.Domain[i].Hash(), stack.Hash(); got != want {
+			t.Fatalf("wrong domain entry %d, got %q, want %q", i, got, want)
+		}
+		if b.DomainIndex[stack.Hash()] != i {
+			t.Fatalf("wrong index for %q", stack.Hash())
+		}
+		if b.Probabilities[i] != a.Probabilities[i] {
+			t.Fatalf("wrong probability for %q, got %f, want %f", stack.Hash(), b.Probabilities[i], a.Probabilities[i])
+		}
+		for d := North; d <= East; d++ {
+			if got, want := b.Neighbors(i, d), a.Neighbors(i, d); len(got) != len(want) {
+				t.Fatalf("wrong %s neighbors of %q, got %v, want %v", d, stack.Hash(), got, want)
+			}
+		}
+	}
+
+	if err := os.WriteFile(filename, []byte(`{"Version": 99}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAnalysis(filename); err == nil {
+		t.Fatal("expected an error loading an unsupported version")
+	}
+}
+
+func TestAllow(t *testing.T) {
+	m := make(Tilemap)
+	m.Put(Stack{{Spritesheet: "a", Index: 1}}, 0, 0)
+	m.Put(Stack{{Spritesheet: "a", Index: 2}}, 1, 0)
+	a := Analyze(m, GridSquare)
+	i, n := a.DomainIndex["a:1"], a.DomainIndex["a:2"]
+	if !a.Allowed(i, East, n) || !a.Allowed(n, West, i) {
+		t.Fatal("expected a:2 east of a:1")
+	}
+	a.Allow(i, East, n, false)
+	if a.Allowed(i, East, n) || a.Allowed(n, West, i) {
+		t.Fatal("expected a:2 not to be allowed east of a:1")
+	}
+	a.Allow(i, North, n, true)
+	if !a.Allowed(i, North, n) || !a.Allowed(n, South, i) {
+		t.Fatal("expected a:2 north of a:1")
+	}
+}
+
+func TestMapRuleset(t *testing.T) {
+	ts := NewTileset()
+	ts.Spritesheets["a"] = &Spritesheet{Name: "a", TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	learn := func(index int) *Analysis {
+		m := NewMap(16, 16, ts)
+		for x := 0; x < 4; x++ {
+			for y := 0; y < 4; y++ {
+				m.Layers[0].Tilemap.Put(Stack{{Spritesheet: "a", Index: index}}, x, y)
+			}
+		}
+		return Analyze(m.Combine(nil), GridSquare)
+	}
+	rules := learn(1).Merge(learn(2))
+	if got, want := len(rules.Domain), 3; got != want {
+		t.Fatalf("wrong merged domain size, got %d, want %d", got, want)
+	}
+	// let 1 and 2 sit side by side, which neither map had
+	rules.Allow(rules.DomainIndex["a:1"], East, rules.DomainIndex["a:2"], true)
+
+	m := NewMap(16, 16, ts)
+	m.Ruleset = rules
+	gen, err := m.NewGeneration(nil, image.Rectangle{}, image.Rect(0, 0, 8, 8), "wfc", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for !gen.Step(1) {
+	}
+	if gen.Err != nil {
+		t.Fatal(gen.Err)
+	}
+	for x, col := range gen.Result() {
+		for y, stack := range col {
+			if h := stack.Hash(); h != "a:1" && h != "a:2" {
+				t.Fatalf("unexpected %q at %d, %d", h, x, y)
+			}
+		}
+	}
+}
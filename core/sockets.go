@@ -0,0 +1,141 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+Sockets are an alternative to learning adjacency from a sample: each edge of a tile is labelled, and two tiles may
+sit side by side when the labels on their touching edges are equal. Labels are kept in a sidecar file next to
+each spritesheet image, e.g. tilesets/dungeon.sockets.json for tilesets/dungeon.png.
+*/
+
+// Socket labels the edges of a tile, indexed by Direction, an empty label never matches. Only the directions of
+// the grid being generated are used, so a tile may have labels for both square and hexagonal grids.
+type Socket [NumDirections]string
+
+// Empty is true if none of the edges are labelled
+func (s Socket) Empty() bool {
+	return s == Socket{}
+}
+
+// Which algorithms learn from sockets, set by the "sockets" option
+const (
+	SocketsOff = iota
+	SocketsOnly
+	SocketsMerged
+)
+
+// SocketsFilename is the sidecar file holding the sockets of the spritesheet image filename
+func SocketsFilename(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + ".sockets.json"
+}
+
+// LoadSockets reads the sidecar sockets file of the spritesheet, if there is one
+func (s *Spritesheet) LoadSockets() error {
+	buf, err := os.ReadFile(SocketsFilename(s.File()))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, &s.Sockets)
+}
+
+// SaveSockets writes the sidecar sockets file of the spritesheet
+func (s *Spritesheet) SaveSockets() error {
+	buf, err := json.MarshalIndent(s.Sockets, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(SocketsFilename(s.File()), buf, 0644)
+}
+
+// SetSocket labels edge d of the tile at index
+func (s *Spritesheet) SetSocket(index int, d Direction, label string) {
+	socket := s.Sockets[index]
+	socket[d] = label
+	if socket.Empty() {
+		delete(s.Sockets, index)
+		return
+	}
+	if s.Sockets == nil {
+		s.Sockets = make(map[int]Socket)
+	}
+	s.Sockets[index] = socket
+}
+
+// LoadSockets reads the sidecar sockets file of every spritesheet
+func (ts *Tileset) LoadSockets() error {
+	for _, sheet := range ts.Spritesheets {
+		if err := sheet.LoadSockets(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AnalyzeSockets builds an analysis whose domain is every tile of the tileset with a socket, equally likely, where
+// tiles may be adjacent on grid when the labels on their touching edges match. Each entry is a stack of a single
+// tile, so when generating several layers at once socket tiles are placed in the first of them.
+func AnalyzeSockets(tileset *Tileset, grid Grid) *Analysis {
+	var names []string
+	for name := range tileset.Spritesheets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	domainIndex := map[string]int{
+		"": 0,
+	}
+	domain := []Stack{nil}
+	var sockets []Socket
+	for _, name := range names {
+		sheet := tileset.Spritesheets[name]
+		var indices []int
+		for i, socket := range sheet.Sockets {
+			if !socket.Empty() {
+				indices = append(indices, i)
+			}
+		}
+		sort.Ints(indices)
+		for _, i := range indices {
+			stack := Stack{{Spritesheet: name, Index: i}}
+			domainIndex[stack.Hash()] = len(domain)
+			domain = append(domain, stack)
+			sockets = append(sockets, sheet.Sockets[i])
+		}
+	}
+	probs := make([]float64, len(domain))
+	adj := NewNDArray[map[int]bool](len(domain), NumDirections)
+	for i := 1; i < len(domain); i++ {
+		probs[i] = 1 / float64(len(domain)-1)
+		for _, d := range grid.Directions() {
+			label := sockets[i-1][d]
+			if label == "" {
+				continue
+			}
+			for n := 1; n < len(domain); n++ {
+				if sockets[n-1][d.Inverse()] != label {
+					continue
+				}
+				a := adj.At(i, int(d))
+				if a == nil {
+					a = make(map[int]bool)
+					adj.Set(a, i, int(d))
+				}
+				a[n] = true
+			}
+		}
+	}
+	return &Analysis{
+		Grid:          grid,
+		Domain:        domain,
+		DomainIndex:   domainIndex,
+		Probabilities: probs,
+		Adj:           adj,
+	}
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnalyzeSockets(t *testing.T) {
+	sheet := &Spritesheet{Name: filepath.Join(t.TempDir(), "roads.png"), TileWidth: 16, TileHeight: 16, Width: 2, Height: 2}
+	// 0 is grass, 1 a road running east to west, 2 a road running north to south
+	for d := North; d <= East; d++ {
+		sheet.SetSocket(0, d, "grass")
+	}
+	sheet.SetSocket(1, North, "grass")
+	sheet.SetSocket(1, South, "grass")
+	sheet.SetSocket(1, West, "road")
+	sheet.SetSocket(1, East, "road")
+	sheet.SetSocket(2, North, "road")
+	sheet.SetSocket(2, South, "road")
+	sheet.SetSocket(2, West, "grass")
+	sheet.SetSocket(2, East, "grass")
+	if err := sheet.SaveSockets(); err != nil {
+		t.Fatal(err)
+	}
+	sheet.Sockets = nil
+	if err := sheet.LoadSockets(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(sheet.Sockets), 3; got != want {
+		t.Fatalf("wrong number of sockets after loading, got %d, want %d", got, want)
+	}
+
+	ts := NewTileset()
+	ts.Spritesheets[sheet.Name] = sheet
+	a := AnalyzeSockets(ts, GridSquare)
+	grass := a.DomainIndex[Stack{{Spritesheet: sheet.Name, Index: 0}}.Hash()]
+	ew := a.DomainIndex[Stack{{Spritesheet: sheet.Name, Index: 1}}.Hash()]
+	ns := a.DomainIndex[Stack{{Spritesheet: sheet.Name, Index: 2}}.Hash()]
+	if !a.Adj.At(ew, int(East))[ew] || !a.Adj.At(ns, int(South))[ns] {
+		t.Fatal("expected roads to continue")
+	}
+	if a.Adj.At(ew, int(East))[ns] || a.Adj.At(ew, int(East))[grass] {
+		t.Fatal("expected roads not to end in grass")
+	}
+	if !a.Adj.At(grass, int(North))[ew] {
+		t.Fatal("expected grass beside a road")
+	}
+
+	gen, err := NewGeneration(nil, nil, GridSquare, ts, image.Rect(0, 0, 8, 8), "wfc", Options{"sockets": SocketsOnly}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for !gen.Step(1) {
+	}
+	if gen.Err != nil {
+		t.Fatal(gen.Err)
+	}
+	result := gen.Result()
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			tile := result[x][y][0]
+			if x < 7 && sheet.Sockets[tile.Index][East] != sheet.Sockets[result[x+1][y][0].Index][West] {
+				t.Fatalf("mismatched sockets at %d, %d", x, y)
+			}
+			if y < 7 && sheet.Sockets[tile.Index][South] != sheet.Sockets[result[x][y+1][0].Index][North] {
+				t.Fatalf("mismatched sockets at %d, %d", x, y)
+			}
+		}
+	}
+}
+
+func TestMergeAnalysis(t *testing.T) {
+	m := make(Tilemap)
+	a, b := &Tile{Spritesheet: "a", Index: 1}, &Tile{Spritesheet: "a", Index: 2}
+	m.Put(Stack{a}, 0, 0)
+	m.Put(Stack{b}, 1, 0)
+	sheet := &Spritesheet{Name: "a", TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	sheet.SetSocket(2, South, "x")
+	sheet.SetSocket(3, North, "x")
+	ts := NewTileset()
+	ts.Spritesheets["a"] = sheet
+	merged := Analyze(m, GridSquare).Merge(AnalyzeSockets(ts, GridSquare))
+	ia, ib := merged.DomainIndex[Stack{a}.Hash()], merged.DomainIndex[Stack{b}.Hash()]
+	ic := merged.DomainIndex[Stack{{Spritesheet: "a", Index: 3}}.Hash()]
+	if !merged.Adj.At(ia, int(East))[ib] {
+		t.Fatal("expected adjacency learned from the sample")
+	}
+	if !merged.Adj.At(ib, int(South))[ic] {
+		t.Fatal("expected adjacency from sockets")
+	}
+	var sum float64
+	for _, p := range merged.Probabilities {
+		sum += p
+	}
+	if sum < 0.999 || sum > 1.001 {
+		t.Fatalf("expected probabilities to sum to 1, got %f", sum)
+	}
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"image"
+	"math/rand"
+	"sort"
+)
+
+// Stamp is a rectangle of cells copied from a map or spritesheet, by layer, relative to its top left corner.
+// Tiles under the empty layer name are painted into whichever layer is active.
+type Stamp struct {
+	Width, Height int
+	Layers        map[string]Tilemap
+	// Order is the names of Layers from the bottom up
+	Order []string
+}
+
+// Copy returns the cells of the named layers within rect as a stamp, or of every layer if names is nil
+func (m *Map) Copy(rect image.Rectangle, names []string) *Stamp {
+	copied := make(map[string]bool)
+	for _, name := range names {
+		copied[name] = true
+	}
+	s := &Stamp{Width: rect.Dx(), Height: rect.Dy(), Layers: make(map[string]Tilemap)}
+	for _, l := range m.Layers {
+		if names != nil && !copied[l.Name] {
+			continue
+		}
+		tilemap := make(Tilemap)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				if stack := l.Tilemap.Get(x, y); len(stack) > 0 {
+					tilemap.Put(stack.Clone(), x-rect.Min.X, y-rect.Min.Y)
+				}
+			}
+		}
+		s.Layers[l.Name] = tilemap
+		s.Order = append(s.Order, l.Name)
+	}
+	return s
+}
+
+// Stamp returns the tiles of s within rect, measured in tiles, as a stamp for the active layer
+func (s *Spritesheet) Stamp(rect image.Rectangle) *Stamp {
+	rect = rect.Intersect(image.Rect(0, 0, s.Width, s.Height))
+	tilemap := make(Tilemap)
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			tilemap.Put(Stack{{Spritesheet: s.Name, Index: y*s.Width + x}}, x-rect.Min.X, y-rect.Min.Y)
+		}
+	}
+	return &Stamp{Width: rect.Dx(), Height: rect.Dy(), Layers: map[string]Tilemap{"": tilemap}, Order: []string{""}}
+}
+
+// Paste writes s into m with its top left corner at x, y. Every cell the stamp covers with a tile in any of its
+// layers is replaced in all of its layers, so stacks are copied whole, while locked layers are left untouched. Layers
+// are pasted in the stamp's Order, then by name, missing ones added as they come, and a layer named active wins over
+// the empty name.
+func (m *Map) Paste(s *Stamp, x, y int, active string, history *History) {
+	if history != nil {
+		history.Begin("paste")
+		defer history.Commit()
+	}
+	covered := make(map[[2]int]bool)
+	for _, tilemap := range s.Layers {
+		tilemap.Each(func(sx, sy int, stack Stack) {
+			covered[[2]int{sx, sy}] = true
+		})
+	}
+	ordered := make(map[string]bool)
+	for _, name := range s.Order {
+		ordered[name] = true
+	}
+	var rest []string
+	for name := range s.Layers {
+		if !ordered[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range append(append([]string(nil), s.Order...), rest...) {
+		tilemap, ok := s.Layers[name]
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if _, ok := s.Layers[active]; ok {
+				continue
+			}
+			name = active
+		}
+		l := m.Layer(name)
+		if l == nil {
+			l = m.AddLayer(name)
+		}
+		if l.Locked {
+			continue
+		}
+		for cell := range covered {
+			mx, my := x+cell[0], y+cell[1]
+			before, after := l.Tilemap.Get(mx, my), tilemap.Get(cell[0], cell[1]).Clone()
+			if before.Hash() == after.Hash() {
+				continue
+			}
+			if history != nil {
+				history.Record(l.Name, mx, my, before.Clone(), after)
+			}
+			l.Tilemap.Put(after, mx, my)
+		}
+	}
+}
+
+// RandomBrush paints single tiles chosen at random from a weighted set
+type RandomBrush struct {
+	Tiles   []*Tile
+	Weights []float64
+}
+
+// Add adds tile to the brush, or increases its weight if it is already there
+func (b *RandomBrush) Add(tile *Tile, weight float64) {
+	for i, t := range b.Tiles {
+		if *t == *tile {
+			b.Weights[i] += weight
+			return
+		}
+	}
+	b.Tiles = append(b.Tiles, tile)
+	b.Weights = append(b.Weights, weight)
+}
+
+func (b *RandomBrush) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.Tiles)
+}
+
+// Pick chooses a tile with probability proportional to its weight, or nil if the brush is empty
+func (b *RandomBrush) Pick(rng *rand.Rand) *Tile {
+	var total float64
+	for _, w := range b.Weights {
+		total += w
+	}
+	ticket := rng.Float64() * total
+	for i, w := range b.Weights {
+		ticket -= w
+		if ticket < 0 {
+			return b.Tiles[i]
+		}
+	}
+	if len(b.Tiles) == 0 {
+		return nil
+	}
+	return b.Tiles[len(b.Tiles)-1]
+}
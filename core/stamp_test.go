@@ -0,0 +1,99 @@
+package core
+
+import (
+	"image"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestCopyPaste(t *testing.T) {
+	m := NewMap(16, 16, NewTileset())
+	floor := m.Layer("Layer 1").Tilemap
+	walls := m.AddLayer("walls").Tilemap
+	a, b := &Tile{Spritesheet: "a", Index: 1}, &Tile{Spritesheet: "b", Index: 2}
+	floor.Put(Stack{a}, 0, 0)
+	walls.Put(Stack{b}, 0, 0)
+	floor.Put(Stack{a}, 1, 0)
+	walls.Put(Stack{b}, 5, 5)
+
+	s := m.Copy(image.Rect(0, 0, 2, 1), nil)
+	h := NewHistory(DefaultHistorySize)
+	m.Paste(s, 4, 5, "Layer 1", h)
+	if got, want := m.Combine(nil).Get(4, 5).Hash(), "a:1,b:2"; got != want {
+		t.Fatalf("wrong stack, got %q, want %q", got, want)
+	}
+	// the whole stack is replaced, clearing the wall that was there
+	if got, want := m.Combine(nil).Get(5, 5).Hash(), "a:1,"; got != want {
+		t.Fatalf("wrong stack, got %q, want %q", got, want)
+	}
+	h.Undo(m)
+	if got, want := walls.Get(5, 5).Hash(), "b:2"; got != want {
+		t.Fatalf("wrong stack after undo, got %q, want %q", got, want)
+	}
+
+	m.Layer("walls").Locked = true
+	m.Paste(s, 10, 10, "Layer 1", nil)
+	if len(walls.Get(10, 10)) != 0 {
+		t.Fatal("expected locked layer to be untouched")
+	}
+}
+
+func TestPasteOrder(t *testing.T) {
+	a, b := &Tile{Spritesheet: "a", Index: 1}, &Tile{Spritesheet: "b", Index: 2}
+	s := &Stamp{Width: 1, Height: 1, Layers: map[string]Tilemap{"": {}, "walls": {}, "c": {}, "b": {}}}
+	s.Layers[""].Put(Stack{a}, 0, 0)
+	s.Layers["walls"].Put(Stack{b}, 0, 0)
+	for i := 0; i < 10; i++ {
+		m := NewMap(16, 16, NewTileset())
+		m.Paste(s, 0, 0, "walls", nil)
+		if got, want := m.Layer("walls").Tilemap.Get(0, 0).Hash(), "b:2"; got != want {
+			t.Fatalf("wrong stack, got %q, want %q", got, want)
+		}
+		if got, want := m.LayerNames(), []string{"Layer 1", "b", "c", "walls"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("wrong layers, got %v, want %v", got, want)
+		}
+	}
+	// layers copied from another map keep their order
+	src := NewMap(16, 16, NewTileset())
+	src.AddLayer("walls").Tilemap.Put(Stack{b}, 0, 0)
+	src.AddLayer("roof").Tilemap.Put(Stack{a}, 0, 0)
+	m := NewMap(16, 16, NewTileset())
+	m.Paste(src.Copy(image.Rect(0, 0, 1, 1), []string{"roof", "walls"}), 0, 0, "Layer 1", nil)
+	if got, want := m.LayerNames(), []string{"Layer 1", "walls", "roof"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong layers, got %v, want %v", got, want)
+	}
+}
+
+func TestSpritesheetStamp(t *testing.T) {
+	sheet := &Spritesheet{Name: "a", TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	s := sheet.Stamp(image.Rect(2, 1, 5, 3))
+	if s.Width != 2 || s.Height != 2 {
+		t.Fatalf("wrong size, got %dx%d, want 2x2", s.Width, s.Height)
+	}
+	m := NewMap(16, 16, NewTileset())
+	m.AddLayer("walls")
+	m.Paste(s, 0, 0, "walls", nil)
+	if got, want := m.Layer("walls").Tilemap.Get(1, 1).Hash(), "a:11"; got != want {
+		t.Fatalf("wrong tile, got %q, want %q", got, want)
+	}
+}
+
+func TestRandomBrush(t *testing.T) {
+	var b RandomBrush
+	a, c := &Tile{Spritesheet: "a", Index: 1}, &Tile{Spritesheet: "c", Index: 3}
+	b.Add(a, 1)
+	b.Add(c, 1)
+	b.Add(&Tile{Spritesheet: "c", Index: 3}, 2)
+	if got, want := b.Len(), 2; got != want {
+		t.Fatalf("wrong number of tiles, got %d, want %d", got, want)
+	}
+	rng := rand.New(rand.NewSource(1))
+	counts := make(map[*Tile]int)
+	for i := 0; i < 4000; i++ {
+		counts[b.Pick(rng)]++
+	}
+	if counts[c] < 2*counts[a] {
+		t.Fatalf("expected weighted picks, got %d of a and %d of c", counts[a], counts[c])
+	}
+}
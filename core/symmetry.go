@@ -0,0 +1,179 @@
+package core
+
+import "fmt"
+
+/*
+Symmetry classes from the tiled model of WFC, describing which rotations and reflections of a tile look the
+same. Analysis.Expand uses them to learn the adjacencies of every distinct variant of a tile from a sample that
+only contains some of them. The classes are named after letters with the same symmetry, and for L and T the
+tile must be drawn in the spritesheet in the orientation of the letter: L joins north and east, and T joins
+west, east and south.
+*/
+type Symmetry uint8
+
+const (
+	// SymmetryNone tiles are never rotated or reflected
+	SymmetryNone = Symmetry(iota)
+	// SymmetryX tiles look the same however they are transformed, e.g. a floor
+	SymmetryX
+	// SymmetryI tiles have two variants, e.g. a straight wall
+	SymmetryI
+	// SymmetryL tiles have four variants, e.g. a corner
+	SymmetryL
+	// SymmetryT tiles have four variants, e.g. a junction
+	SymmetryT
+	// SymmetryBackslash tiles have two variants, e.g. a diagonal
+	SymmetryBackslash
+	// SymmetryF tiles have all eight variants, as they have no symmetry of their own
+	SymmetryF
+)
+
+var symmetryNames = []string{"", "X", "I", "L", "T", "\\", "F"}
+
+// SymmetryClasses lists every class in the order the editor cycles through them
+var SymmetryClasses = []Symmetry{SymmetryNone, SymmetryX, SymmetryI, SymmetryL, SymmetryT, SymmetryBackslash, SymmetryF}
+
+func (s Symmetry) String() string {
+	if int(s) < len(symmetryNames) {
+		return symmetryNames[s]
+	}
+	return fmt.Sprintf("Symmetry(%d)", s)
+}
+
+func (s Symmetry) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Symmetry) UnmarshalText(text []byte) error {
+	for i, name := range symmetryNames {
+		if string(text) == name {
+			*s = Symmetry(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown symmetry %q", text)
+}
+
+// stabilizer is every transform that leaves a tile of the class looking the same
+func (s Symmetry) stabilizer() []Flip {
+	switch s {
+	case SymmetryX:
+		return Transforms[:]
+	case SymmetryI:
+		return []Flip{0, FlipHorizontal, FlipVertical, FlipHorizontal | FlipVertical}
+	case SymmetryL:
+		return []Flip{0, FlipDiagonal | FlipHorizontal | FlipVertical}
+	case SymmetryT:
+		return []Flip{0, FlipHorizontal}
+	case SymmetryBackslash:
+		return []Flip{0, FlipDiagonal, FlipHorizontal | FlipVertical, FlipDiagonal | FlipHorizontal | FlipVertical}
+	default:
+		return []Flip{0}
+	}
+}
+
+// Canonical returns the flip with the lowest value that draws a tile of the class the same as f
+func (s Symmetry) Canonical(f Flip) Flip {
+	c := f
+	for _, t := range s.stabilizer() {
+		if g := f.Compose(t); g < c {
+			c = g
+		}
+	}
+	return c
+}
+
+// Transforms is every rotation and reflection of a square, the identity first
+var Transforms = [8]Flip{0, 1, 2, 3, 4, 5, 6, 7}
+
+// RotateClockwise turns a tile a quarter turn clockwise
+const RotateClockwise = FlipDiagonal | FlipHorizontal
+
+// matrix is the transform f applies to vectors, with y pointing down as in images
+func (f Flip) matrix() [2][2]int {
+	m := [2][2]int{{1, 0}, {0, 1}}
+	if f&FlipDiagonal != 0 {
+		m = [2][2]int{{0, 1}, {1, 0}}
+	}
+	if f&FlipHorizontal != 0 {
+		m[0][0], m[0][1] = -m[0][0], -m[0][1]
+	}
+	if f&FlipVertical != 0 {
+		m[1][0], m[1][1] = -m[1][0], -m[1][1]
+	}
+	return m
+}
+
+// Compose returns the transform applying g and then f
+func (f Flip) Compose(g Flip) Flip {
+	a, b := f.matrix(), g.matrix()
+	var m [2][2]int
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			m[i][j] = a[i][0]*b[0][j] + a[i][1]*b[1][j]
+		}
+	}
+	for _, t := range Transforms {
+		if t.matrix() == m {
+			return t
+		}
+	}
+	panic("unreachable")
+}
+
+// Direction returns the direction d points in once transformed by f
+func (f Flip) Direction(d Direction) Direction {
+	m := f.matrix()
+	o := Neighbors[d]
+	x, y := m[0][0]*o[0]+m[0][1]*o[1], m[1][0]*o[0]+m[1][1]*o[1]
+	for n, o := range Neighbors {
+		if o[0] == x && o[1] == y {
+			return Direction(n)
+		}
+	}
+	panic("unreachable")
+}
+
+// SymmetryLookup finds the symmetry class of a tile
+type SymmetryLookup interface {
+	Symmetry(t *Tile) Symmetry
+}
+
+// Symmetry is the class of t set on its spritesheet, SymmetryNone if there is none
+func (ts *Tileset) Symmetry(t *Tile) Symmetry {
+	if ts == nil || t == nil {
+		return SymmetryNone
+	}
+	return ts.Spritesheets[t.Spritesheet].Symmetry(t.Index)
+}
+
+// transformStack applies f to every tile of s, returning false if any of them can't be transformed
+func transformStack(s Stack, f Flip, sym SymmetryLookup) (Stack, bool) {
+	r := make(Stack, len(s))
+	for i, t := range s {
+		if t == nil {
+			continue
+		}
+		class := sym.Symmetry(t)
+		if class == SymmetryNone {
+			if f != 0 {
+				return nil, false
+			}
+			r[i] = t
+			continue
+		}
+		r[i] = &Tile{Spritesheet: t.Spritesheet, Index: t.Index, Flip: class.Canonical(f.Compose(t.Flip))}
+	}
+	return r, true
+}
+
+// canonicalTilemap returns a copy of tilemap with every tile in the canonical orientation for its class, so that
+// tiles which look the same have the same hash
+func canonicalTilemap(tilemap Tilemap, sym SymmetryLookup) Tilemap {
+	r := make(Tilemap)
+	tilemap.Each(func(x, y int, stack Stack) {
+		s, _ := transformStack(stack, 0, sym)
+		r.Put(s, x, y)
+	})
+	return r
+}
@@ -0,0 +1,80 @@
+package core
+
+import "testing"
+
+func TestFlipCompose(t *testing.T) {
+	f := Flip(0)
+	for i := 0; i < 4; i++ {
+		f = RotateClockwise.Compose(f)
+		if i < 3 && f == 0 {
+			t.Fatalf("expected %d quarter turns not to be the identity", i+1)
+		}
+	}
+	if f != 0 {
+		t.Fatalf("expected four quarter turns to be the identity, got %d", f)
+	}
+	if got, want := RotateClockwise.Direction(North), East; got != want {
+		t.Fatalf("wrong direction, got %v, want %v", got, want)
+	}
+	if got, want := FlipHorizontal.Direction(West), East; got != want {
+		t.Fatalf("wrong direction, got %v, want %v", got, want)
+	}
+	// the transform matches how tiles are drawn
+	x, y := RotateClockwise.Transform(0, 0, 16, 16)
+	if x != 15 || y != 0 {
+		t.Fatalf("expected the top left corner to turn to the top right, got %d, %d", x, y)
+	}
+}
+
+func TestSymmetryVariants(t *testing.T) {
+	for class, want := range map[Symmetry]int{
+		SymmetryNone:      1,
+		SymmetryX:         1,
+		SymmetryI:         2,
+		SymmetryL:         4,
+		SymmetryT:         4,
+		SymmetryBackslash: 2,
+		SymmetryF:         8,
+	} {
+		variants := make(map[Flip]bool)
+		for _, f := range Transforms {
+			variants[class.Canonical(f)] = true
+		}
+		if class == SymmetryNone {
+			continue
+		}
+		if got := len(variants); got != want {
+			t.Fatalf("%v: wrong number of variants, got %d, want %d", class, got, want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	ts := NewTileset()
+	ts.Spritesheets["a"] = &Spritesheet{Name: "a", TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	ts.Spritesheets["a"].SetSymmetry(0, SymmetryX)
+	ts.Spritesheets["a"].SetSymmetry(1, SymmetryI)
+	floor, wall := &Tile{Spritesheet: "a", Index: 0}, &Tile{Spritesheet: "a", Index: 1}
+	// a wall running north to south between two columns of floor
+	m := make(Tilemap)
+	for y := 0; y < 3; y++ {
+		m.Put(Stack{floor}, 0, y)
+		m.Put(Stack{wall}, 1, y)
+		m.Put(Stack{floor}, 2, y)
+	}
+	a := Analyze(m, GridSquare).Expand(ts)
+	turned := Stack{{Spritesheet: "a", Index: 1, Flip: SymmetryI.Canonical(RotateClockwise)}}
+	i, ok := a.DomainIndex[turned.Hash()]
+	if !ok {
+		t.Fatalf("expected a turned wall in the domain, got %v", a.DomainIndex)
+	}
+	if !a.Adj.At(i, int(East))[i] {
+		t.Fatal("expected turned walls to continue east")
+	}
+	if a.Adj.At(i, int(North))[i] {
+		t.Fatal("expected turned walls not to continue north")
+	}
+	if got, want := len(a.Domain), 4; got != want {
+		t.Fatalf("wrong domain size, got %d, want %d", got, want)
+	}
+}
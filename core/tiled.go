@@ -0,0 +1,1080 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Import and export of maps made with the Tiled editor (https://www.mapeditor.org), in either its TMX/TSX XML
+formats or its JSON formats. Each Tiled tileset becomes a Spritesheet named after its image, and each tile layer
+becomes one level of the Stack in every cell, so the first layer is at the bottom. Orthogonal maps have a square
+grid and hexagonal maps a hex grid, Tiled has no 8-connected grid so those are exported as orthogonal. Tile
+Properties become Tiled's custom properties of the tile, with tags as a comma separated "tags" string, and animated
+tiles keep their animation.
+*/
+
+const (
+	tiledFlipHorizontal = 0x80000000
+	tiledFlipVertical   = 0x40000000
+	tiledFlipDiagonal   = 0x20000000
+	tiledRotateHex      = 0x10000000
+	tiledFlags          = tiledFlipHorizontal | tiledFlipVertical | tiledFlipDiagonal | tiledRotateHex
+)
+
+// tiledMap is the format independent contents of a Tiled map
+type tiledMap struct {
+	tileWidth, tileHeight int
+	grid                  Grid
+	// shift moves every tile, to turn a map with an even stagger index into an odd one
+	shift    image.Point
+	tilesets []*tiledTileset
+	layers   []*tiledLayer
+}
+
+type tiledLayer struct {
+	name            string
+	visible, locked bool
+	opacity         float64
+	chunks          []tiledChunk
+}
+
+type tiledTileset struct {
+	firstGID              int
+	name                  string
+	image                 string
+	imageWidth            int
+	imageHeight           int
+	tileWidth, tileHeight int
+	spacing, margin       int
+	offsetX, offsetY      int
+	count, columns        int
+	properties            map[int]*Properties
+	animations            map[int]Animation
+}
+
+type tiledChunk struct {
+	x, y, width, height int
+	gids                []uint32
+}
+
+// ImportTiled reads a Tiled map from a .tmx file, or a .tmj or .json file in Tiled's JSON format
+func ImportTiled(filename string) (*Map, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dir := filepath.Dir(filename)
+	var m *Map
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".tmx":
+		m, err = ReadTMX(f, dir)
+	case ".tmj", ".json":
+		m, err = ReadTiledJSON(f, dir)
+	default:
+		return nil, fmt.Errorf("%s: not a Tiled map", filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := m.Tileset.LoadSockets(); err != nil {
+		return nil, err
+	}
+	return m, m.Tileset.LoadProperties()
+}
+
+// ExportTiled writes m as a .tmx file, or a .tmj or .json file in Tiled's JSON format
+func ExportTiled(m *Map, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(filename)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".tmx":
+		err = WriteTMX(f, m, dir)
+	case ".tmj", ".json":
+		err = WriteTiledJSON(f, m, dir)
+	default:
+		err = fmt.Errorf("%s: not a Tiled map", filename)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (tm *tiledMap) build() (*Map, error) {
+	m := NewMap(tm.tileWidth, tm.tileHeight, NewTileset())
+	m.Grid = tm.grid
+	sort.Slice(tm.tilesets, func(i, j int) bool {
+		return tm.tilesets[i].firstGID < tm.tilesets[j].firstGID
+	})
+	for _, ts := range tm.tilesets {
+		if ts.columns <= 0 {
+			return nil, fmt.Errorf("tileset %q: tilesets without a single image are not supported", ts.name)
+		}
+		m.Spritesheets[ts.image] = &Spritesheet{
+			Name:       ts.image,
+			TileWidth:  ts.tileWidth,
+			TileHeight: ts.tileHeight,
+			Spacing:    ts.spacing,
+			Margin:     ts.margin,
+			OffsetX:    ts.offsetX,
+			OffsetY:    ts.offsetY,
+			Width:      ts.columns,
+			Height:     (ts.count + ts.columns - 1) / ts.columns,
+			// the properties in the sidecar file beside the image, if there is one, are loaded over these
+			Properties: ts.properties,
+			Animations: ts.animations,
+		}
+	}
+	m.Layers = nil
+	for _, tl := range tm.layers {
+		name := tl.name
+		for i := 2; name == "" || m.Layer(name) != nil; i++ {
+			// layers in different groups may share a name
+			name = fmt.Sprintf("%s %d", tl.name, i)
+		}
+		l := m.AddLayer(name)
+		l.Visible, l.Locked, l.Opacity = tl.visible, tl.locked, tl.opacity
+		for _, chunk := range tl.chunks {
+			for i, gid := range chunk.gids {
+				if gid&^tiledFlags == 0 {
+					continue
+				}
+				tile, err := tm.tile(gid)
+				if err != nil {
+					return nil, err
+				}
+				l.Tilemap.Put(Stack{tile}, tm.shift.X+chunk.x+i%chunk.width, tm.shift.Y+chunk.y+i/chunk.width)
+			}
+		}
+	}
+	if len(m.Layers) == 0 {
+		m.AddLayer("Layer 1")
+	}
+	return m, nil
+}
+
+func (tm *tiledMap) tile(gid uint32) (*Tile, error) {
+	id := int(gid &^ tiledFlags)
+	var ts *tiledTileset
+	for _, t := range tm.tilesets {
+		if t.firstGID <= id {
+			ts = t
+		}
+	}
+	if ts == nil {
+		return nil, fmt.Errorf("no tileset for tile %d", id)
+	}
+	tile := &Tile{Spritesheet: ts.image, Index: id - ts.firstGID}
+	if gid&tiledFlipHorizontal != 0 {
+		tile.Flip |= FlipHorizontal
+	}
+	if gid&tiledFlipVertical != 0 {
+		tile.Flip |= FlipVertical
+	}
+	if gid&tiledFlipDiagonal != 0 {
+		tile.Flip |= FlipDiagonal
+	}
+	return tile, nil
+}
+
+// tiledTagsProperty is the Tiled custom property holding the tags of a tile
+const tiledTagsProperty = "tags"
+
+// tiledProperties calls f with each value of p as a Tiled custom property, in order of name, its tags taking the
+// place of any value named "tags"
+func tiledProperties(p *Properties, f func(name, typ string, value interface{})) {
+	if p == nil {
+		return
+	}
+	values := make(map[string]interface{})
+	for k, v := range p.Values {
+		values[k] = v
+	}
+	if len(p.Tags) > 0 {
+		values[tiledTagsProperty] = strings.Join(p.Tags, ",")
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch v := values[name].(type) {
+		case bool:
+			f(name, "bool", v)
+		case float64:
+			f(name, "float", v)
+		case string:
+			f(name, "string", v)
+		}
+	}
+}
+
+// setTiledProperty sets a Tiled custom property of a tile, value being a bool, a number or a string, or is ignored
+func (ts *tiledTileset) setTiledProperty(id int, name string, value interface{}) {
+	switch value.(type) {
+	case bool, float64, string:
+	default:
+		return
+	}
+	if ts.properties == nil {
+		ts.properties = make(map[int]*Properties)
+	}
+	p := ts.properties[id]
+	if p == nil {
+		p = new(Properties)
+		ts.properties[id] = p
+	}
+	if s, ok := value.(string); ok && name == tiledTagsProperty {
+		p.SetTags(strings.Split(s, ","))
+		return
+	}
+	p.Set(name, value)
+}
+
+// setTiledAnimation animates a tile with the frames of a Tiled animation
+func (ts *tiledTileset) setTiledAnimation(id int, a Animation) {
+	if len(a) == 0 {
+		return
+	}
+	if ts.animations == nil {
+		ts.animations = make(map[int]Animation)
+	}
+	ts.animations[id] = a
+}
+
+// tileIDs are the indices of the tiles of ts with properties or an animation, sorted
+func (ts *tiledTileset) tileIDs() []int {
+	var ids []int
+	for id, p := range ts.properties {
+		if !p.Empty() {
+			ids = append(ids, id)
+		}
+	}
+	for id := range ts.animations {
+		if ts.properties[id].Empty() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// tiledGrid is the grid of a Tiled map's orientation, along with the shift that makes its stagger index odd
+func tiledGrid(orientation, staggerAxis, staggerIndex string) (Grid, image.Point, error) {
+	switch orientation {
+	case "", "orthogonal":
+		return GridSquare, image.Point{}, nil
+	case "hexagonal":
+		var shift image.Point
+		grid := GridHexPointy
+		if staggerAxis == "x" {
+			grid = GridHexFlat
+		}
+		if staggerIndex == "even" {
+			if grid == GridHexFlat {
+				shift.X = 1
+			} else {
+				shift.Y = 1
+			}
+		}
+		return grid, shift, nil
+	}
+	return 0, image.Point{}, fmt.Errorf("unsupported orientation %q", orientation)
+}
+
+// orientation is the inverse of tiledGrid, along with the length of the side of a hex along the stagger axis
+func (tm *tiledMap) orientation() (orientation, staggerAxis, staggerIndex string, hexSide int) {
+	switch tm.grid {
+	case GridHexPointy:
+		return "hexagonal", "y", "odd", tm.tileHeight / 2
+	case GridHexFlat:
+		return "hexagonal", "x", "odd", tm.tileWidth / 2
+	}
+	return "orthogonal", "", "", 0
+}
+
+// newTiledMap lays m out as Tiled expects, with the top left of its bounds at the origin
+func newTiledMap(m *Map, dir string) (*tiledMap, int, int) {
+	var bounds image.Rectangle
+	for _, l := range m.Layers {
+		if b := l.Tilemap.Bounds(); !b.Empty() {
+			if bounds.Empty() {
+				bounds = b
+			} else {
+				bounds = bounds.Union(b)
+			}
+		}
+	}
+	// moving a hex map by an odd number of rows or columns would change which are shifted
+	if m.Grid == GridHexPointy && bounds.Min.Y&1 != 0 {
+		bounds.Min.Y--
+	} else if m.Grid == GridHexFlat && bounds.Min.X&1 != 0 {
+		bounds.Min.X--
+	}
+	tm := &tiledMap{tileWidth: m.TileWidth, tileHeight: m.TileHeight, grid: m.Grid}
+	if tm.grid == GridSquare8 {
+		tm.grid = GridSquare
+	}
+	var names []string
+	for name := range m.Spritesheets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	firstGIDs := make(map[string]int)
+	gid := 1
+	for _, name := range names {
+		sheet := m.Spritesheets[name]
+		src := filepath.ToSlash(relativePath(dir, sheet.File()))
+		ts := &tiledTileset{
+			firstGID:   gid,
+			name:       strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)),
+			image:      src,
+			tileWidth:  sheet.TileWidth,
+			tileHeight: sheet.TileHeight,
+			spacing:    sheet.Spacing,
+			margin:     sheet.Margin,
+			offsetX:    sheet.OffsetX,
+			offsetY:    sheet.OffsetY,
+			count:      sheet.Len(),
+			columns:    sheet.Width,
+			properties: sheet.Properties,
+			animations: sheet.Animations,
+		}
+		if sheet.Image != nil {
+			ts.imageWidth, ts.imageHeight = sheet.Image.Bounds().Dx(), sheet.Image.Bounds().Dy()
+		}
+		tm.tilesets = append(tm.tilesets, ts)
+		firstGIDs[name] = gid
+		gid += sheet.Len()
+	}
+	for _, l := range m.Layers {
+		chunk := tiledChunk{width: bounds.Dx(), height: bounds.Dy(), gids: make([]uint32, bounds.Dx()*bounds.Dy())}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				tile := l.Tilemap.At(x, y, len(l.Tilemap.Get(x, y))-1)
+				if tile == nil {
+					continue
+				}
+				first, ok := firstGIDs[tile.Spritesheet]
+				if !ok {
+					continue
+				}
+				gid := uint32(first + tile.Index)
+				if tile.Flip&FlipHorizontal != 0 {
+					gid |= tiledFlipHorizontal
+				}
+				if tile.Flip&FlipVertical != 0 {
+					gid |= tiledFlipVertical
+				}
+				if tile.Flip&FlipDiagonal != 0 {
+					gid |= tiledFlipDiagonal
+				}
+				chunk.gids[(x-bounds.Min.X)+(y-bounds.Min.Y)*bounds.Dx()] = gid
+			}
+		}
+		tm.layers = append(tm.layers, &tiledLayer{
+			name:    l.Name,
+			visible: l.Visible,
+			locked:  l.Locked,
+			opacity: l.Opacity,
+			chunks:  []tiledChunk{chunk},
+		})
+	}
+	return tm, bounds.Dx(), bounds.Dy()
+}
+
+// relativePath is filename relative to dir if possible, otherwise filename itself
+func relativePath(dir, filename string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return filename
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return filename
+	}
+	rel, err := filepath.Rel(absDir, abs)
+	if err != nil {
+		return filename
+	}
+	return rel
+}
+
+// resolvePath joins a path from a Tiled file to the directory containing it, keeping it relative to the
+// working directory when it is inside it so spritesheet names match those of maps saved by the editor
+func resolvePath(dir, source string) string {
+	filename := filepath.Join(dir, filepath.FromSlash(source))
+	if !filepath.IsAbs(filename) {
+		return filename
+	}
+	if rel := relativePath(".", filename); !strings.HasPrefix(rel, "..") && !filepath.IsAbs(rel) {
+		return rel
+	}
+	return filename
+}
+
+// decodeGIDs decodes the contents of a layer or chunk's data in any of Tiled's encodings
+func decodeGIDs(encoding, compression, data string, n int) ([]uint32, error) {
+	switch encoding {
+	case "csv":
+		var gids []uint32
+		for _, s := range strings.Split(data, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			gid, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			gids = append(gids, uint32(gid))
+		}
+		return gids, nil
+	case "base64":
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err != nil {
+			return nil, err
+		}
+		var r io.Reader = bytes.NewReader(b)
+		switch compression {
+		case "":
+		case "zlib":
+			if r, err = zlib.NewReader(r); err != nil {
+				return nil, err
+			}
+		case "gzip":
+			if r, err = gzip.NewReader(r); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported compression %q", compression)
+		}
+		gids := make([]uint32, n)
+		if err := binary.Read(r, binary.LittleEndian, gids); err != nil {
+			return nil, err
+		}
+		return gids, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+func encodeCSV(gids []uint32, width int) string {
+	buf := new(strings.Builder)
+	buf.WriteByte('\n')
+	for i, gid := range gids {
+		buf.WriteString(strconv.FormatUint(uint64(gid), 10))
+		if i < len(gids)-1 {
+			buf.WriteByte(',')
+		}
+		if (i+1)%width == 0 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.String()
+}
+
+type tmxMap struct {
+	XMLName       xml.Name     `xml:"map"`
+	Version       string       `xml:"version,attr"`
+	Orientation   string       `xml:"orientation,attr"`
+	RenderOrder   string       `xml:"renderorder,attr"`
+	Width         int          `xml:"width,attr"`
+	Height        int          `xml:"height,attr"`
+	TileWidth     int          `xml:"tilewidth,attr"`
+	TileHeight    int          `xml:"tileheight,attr"`
+	HexSideLength int          `xml:"hexsidelength,attr,omitempty"`
+	StaggerAxis   string       `xml:"staggeraxis,attr,omitempty"`
+	StaggerIndex  string       `xml:"staggerindex,attr,omitempty"`
+	Infinite      int          `xml:"infinite,attr"`
+	NextLayerID   int          `xml:"nextlayerid,attr"`
+	NextObjectID  int          `xml:"nextobjectid,attr"`
+	Tilesets      []tmxTileset `xml:"tileset"`
+	Layers        []tmxLayer   `xml:"layer"`
+}
+
+type tmxTileset struct {
+	XMLName    xml.Name         `xml:"tileset"`
+	Version    string           `xml:"version,attr,omitempty"`
+	FirstGID   int              `xml:"firstgid,attr,omitempty"`
+	Source     string           `xml:"source,attr,omitempty"`
+	Name       string           `xml:"name,attr,omitempty"`
+	TileWidth  int              `xml:"tilewidth,attr,omitempty"`
+	TileHeight int              `xml:"tileheight,attr,omitempty"`
+	Spacing    int              `xml:"spacing,attr,omitempty"`
+	Margin     int              `xml:"margin,attr,omitempty"`
+	TileCount  int              `xml:"tilecount,attr,omitempty"`
+	Columns    int              `xml:"columns,attr,omitempty"`
+	TileOffset *tmxTileOffset   `xml:"tileoffset"`
+	Image      *tmxImage        `xml:"image"`
+	Tiles      []tmxTilesetTile `xml:"tile"`
+}
+
+type tmxTileOffset struct {
+	X int `xml:"x,attr"`
+	Y int `xml:"y,attr"`
+}
+
+type tmxTilesetTile struct {
+	ID         int           `xml:"id,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+	Animation  []tmxFrame    `xml:"animation>frame"`
+}
+
+type tmxFrame struct {
+	TileID   int `xml:"tileid,attr"`
+	Duration int `xml:"duration,attr"`
+}
+
+type tmxProperty struct {
+	Name  string `xml:"name,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:"value,attr"`
+}
+
+type tmxImage struct {
+	Source string `xml:"source,attr"`
+	Width  int    `xml:"width,attr,omitempty"`
+	Height int    `xml:"height,attr,omitempty"`
+}
+
+type tmxLayer struct {
+	ID      int      `xml:"id,attr"`
+	Name    string   `xml:"name,attr"`
+	Width   int      `xml:"width,attr"`
+	Height  int      `xml:"height,attr"`
+	Visible *int     `xml:"visible,attr"`
+	Locked  int      `xml:"locked,attr,omitempty"`
+	Opacity *float64 `xml:"opacity,attr"`
+	Data    tmxData  `xml:"data"`
+}
+
+type tmxData struct {
+	Encoding    string     `xml:"encoding,attr,omitempty"`
+	Compression string     `xml:"compression,attr,omitempty"`
+	Content     string     `xml:",chardata"`
+	Raw         string     `xml:",innerxml"`
+	Tiles       []tmxTile  `xml:"tile"`
+	Chunks      []tmxChunk `xml:"chunk"`
+}
+
+type tmxChunk struct {
+	X       int       `xml:"x,attr"`
+	Y       int       `xml:"y,attr"`
+	Width   int       `xml:"width,attr"`
+	Height  int       `xml:"height,attr"`
+	Content string    `xml:",chardata"`
+	Tiles   []tmxTile `xml:"tile"`
+}
+
+type tmxTile struct {
+	GID uint32 `xml:"gid,attr"`
+}
+
+func tmxChunkData(encoding, compression, content string, tiles []tmxTile, x, y, width, height int) (tiledChunk, error) {
+	chunk := tiledChunk{x: x, y: y, width: width, height: height}
+	if encoding == "" {
+		for _, t := range tiles {
+			chunk.gids = append(chunk.gids, t.GID)
+		}
+		return chunk, nil
+	}
+	var err error
+	chunk.gids, err = decodeGIDs(encoding, compression, content, width*height)
+	return chunk, err
+}
+
+func ReadTMX(r io.Reader, dir string) (*Map, error) {
+	var doc tmxMap
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	grid, shift, err := tiledGrid(doc.Orientation, doc.StaggerAxis, doc.StaggerIndex)
+	if err != nil {
+		return nil, err
+	}
+	tm := &tiledMap{tileWidth: doc.TileWidth, tileHeight: doc.TileHeight, grid: grid, shift: shift}
+	for _, t := range doc.Tilesets {
+		ts, err := readTMXTileset(t, dir)
+		if err != nil {
+			return nil, err
+		}
+		tm.tilesets = append(tm.tilesets, ts)
+	}
+	for _, l := range doc.Layers {
+		layer := &tiledLayer{name: l.Name, visible: l.Visible == nil || *l.Visible != 0, locked: l.Locked != 0, opacity: 1}
+		if l.Opacity != nil {
+			layer.opacity = *l.Opacity
+		}
+		d := l.Data
+		if len(d.Chunks) > 0 {
+			for _, c := range d.Chunks {
+				chunk, err := tmxChunkData(d.Encoding, d.Compression, c.Content, c.Tiles, c.X, c.Y, c.Width, c.Height)
+				if err != nil {
+					return nil, fmt.Errorf("layer %q: %w", l.Name, err)
+				}
+				layer.chunks = append(layer.chunks, chunk)
+			}
+		} else {
+			chunk, err := tmxChunkData(d.Encoding, d.Compression, d.Content, d.Tiles, 0, 0, l.Width, l.Height)
+			if err != nil {
+				return nil, fmt.Errorf("layer %q: %w", l.Name, err)
+			}
+			layer.chunks = append(layer.chunks, chunk)
+		}
+		tm.layers = append(tm.layers, layer)
+	}
+	return tm.build()
+}
+
+// readTMXTileset converts a tileset embedded in a TMX file, or loads the TSX or JSON file it refers to
+func readTMXTileset(t tmxTileset, dir string) (*tiledTileset, error) {
+	firstGID := t.FirstGID
+	if t.Source != "" {
+		filename := filepath.Join(dir, t.Source)
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		var ts *tiledTileset
+		if ext := strings.ToLower(filepath.Ext(filename)); ext == ".tsj" || ext == ".json" {
+			ts, err = readTSJ(f, filepath.Dir(filename))
+		} else {
+			ts, err = readTSX(f, filepath.Dir(filename))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		ts.firstGID = firstGID
+		return ts, nil
+	}
+	ts := &tiledTileset{
+		firstGID:   firstGID,
+		name:       t.Name,
+		tileWidth:  t.TileWidth,
+		tileHeight: t.TileHeight,
+		spacing:    t.Spacing,
+		margin:     t.Margin,
+		count:      t.TileCount,
+		columns:    t.Columns,
+	}
+	if t.Image != nil {
+		ts.image = resolvePath(dir, t.Image.Source)
+		ts.imageWidth, ts.imageHeight = t.Image.Width, t.Image.Height
+	}
+	if t.TileOffset != nil {
+		ts.offsetX, ts.offsetY = t.TileOffset.X, t.TileOffset.Y
+	}
+	for _, tile := range t.Tiles {
+		for _, prop := range tile.Properties {
+			var value interface{} = prop.Value
+			switch prop.Type {
+			case "bool":
+				value = prop.Value == "true"
+			case "int", "float":
+				f, err := strconv.ParseFloat(prop.Value, 64)
+				if err != nil {
+					return nil, fmt.Errorf("tile %d: property %q: %w", tile.ID, prop.Name, err)
+				}
+				value = f
+			}
+			ts.setTiledProperty(tile.ID, prop.Name, value)
+		}
+		var a Animation
+		for _, f := range tile.Animation {
+			a = append(a, Frame{Index: f.TileID, Duration: f.Duration})
+		}
+		ts.setTiledAnimation(tile.ID, a)
+	}
+	return ts, nil
+}
+
+// readTSX reads an external Tiled tileset, resolving its image relative to dir
+func readTSX(r io.Reader, dir string) (*tiledTileset, error) {
+	var t tmxTileset
+	if err := xml.NewDecoder(r).Decode(&t); err != nil {
+		return nil, err
+	}
+	t.Source = ""
+	return readTMXTileset(t, dir)
+}
+
+func (ts *tiledTileset) tmx() tmxTileset {
+	t := tmxTileset{
+		FirstGID:   ts.firstGID,
+		Name:       ts.name,
+		TileWidth:  ts.tileWidth,
+		TileHeight: ts.tileHeight,
+		Spacing:    ts.spacing,
+		Margin:     ts.margin,
+		TileCount:  ts.count,
+		Columns:    ts.columns,
+		Image:      &tmxImage{Source: ts.image, Width: ts.imageWidth, Height: ts.imageHeight},
+	}
+	if ts.offsetX != 0 || ts.offsetY != 0 {
+		t.TileOffset = &tmxTileOffset{X: ts.offsetX, Y: ts.offsetY}
+	}
+	for _, id := range ts.tileIDs() {
+		tile := tmxTilesetTile{ID: id}
+		tiledProperties(ts.properties[id], func(name, typ string, value interface{}) {
+			tile.Properties = append(tile.Properties, tmxProperty{Name: name, Type: typ, Value: FormatValue(value)})
+		})
+		for _, f := range ts.animations[id] {
+			tile.Animation = append(tile.Animation, tmxFrame{TileID: f.Index, Duration: f.Duration})
+		}
+		t.Tiles = append(t.Tiles, tile)
+	}
+	return t
+}
+
+func WriteTMX(w io.Writer, m *Map, dir string) error {
+	tm, width, height := newTiledMap(m, dir)
+	doc := tmxMap{
+		Version:      "1.10",
+		RenderOrder:  "right-down",
+		Width:        width,
+		Height:       height,
+		TileWidth:    tm.tileWidth,
+		TileHeight:   tm.tileHeight,
+		NextLayerID:  len(tm.layers) + 1,
+		NextObjectID: 1,
+	}
+	doc.Orientation, doc.StaggerAxis, doc.StaggerIndex, doc.HexSideLength = tm.orientation()
+	for _, ts := range tm.tilesets {
+		doc.Tilesets = append(doc.Tilesets, ts.tmx())
+	}
+	for i, layer := range tm.layers {
+		l := tmxLayer{
+			ID:     i + 1,
+			Name:   layer.name,
+			Width:  width,
+			Height: height,
+			Data:   tmxData{Encoding: "csv", Raw: encodeCSV(layer.chunks[0].gids, width)},
+		}
+		if !layer.visible {
+			l.Visible = new(int)
+		}
+		if layer.locked {
+			l.Locked = 1
+		}
+		if layer.opacity != 1 {
+			l.Opacity = &layer.opacity
+		}
+		doc.Layers = append(doc.Layers, l)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteTSX writes sheet as an external Tiled tileset, with its image relative to dir
+func WriteTSX(w io.Writer, sheet *Spritesheet, dir string) error {
+	tm, _, _ := newTiledMap(&Map{Tileset: &Tileset{Spritesheets: map[string]*Spritesheet{sheet.Name: sheet}}}, dir)
+	t := tm.tilesets[0].tmx()
+	t.FirstGID = 0
+	t.Version = "1.10"
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	if err := enc.Encode(t); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type tiledJSONMap struct {
+	Type          string             `json:"type"`
+	Version       string             `json:"version"`
+	Orientation   string             `json:"orientation"`
+	RenderOrder   string             `json:"renderorder"`
+	Width         int                `json:"width"`
+	Height        int                `json:"height"`
+	TileWidth     int                `json:"tilewidth"`
+	TileHeight    int                `json:"tileheight"`
+	HexSideLength int                `json:"hexsidelength,omitempty"`
+	StaggerAxis   string             `json:"staggeraxis,omitempty"`
+	StaggerIndex  string             `json:"staggerindex,omitempty"`
+	Infinite      bool               `json:"infinite"`
+	NextLayerID   int                `json:"nextlayerid"`
+	NextObjectID  int                `json:"nextobjectid"`
+	Layers        []tiledJSONLayer   `json:"layers"`
+	Tilesets      []tiledJSONTileset `json:"tilesets"`
+}
+
+type tiledJSONLayer struct {
+	ID          int              `json:"id"`
+	Name        string           `json:"name"`
+	Type        string           `json:"type"`
+	X           int              `json:"x"`
+	Y           int              `json:"y"`
+	Width       int              `json:"width"`
+	Height      int              `json:"height"`
+	Opacity     float64          `json:"opacity"`
+	Visible     bool             `json:"visible"`
+	Locked      bool             `json:"locked,omitempty"`
+	Encoding    string           `json:"encoding,omitempty"`
+	Compression string           `json:"compression,omitempty"`
+	Data        json.RawMessage  `json:"data,omitempty"`
+	Chunks      []tiledJSONChunk `json:"chunks,omitempty"`
+	Layers      []tiledJSONLayer `json:"layers,omitempty"`
+}
+
+type tiledJSONChunk struct {
+	X      int             `json:"x"`
+	Y      int             `json:"y"`
+	Width  int             `json:"width"`
+	Height int             `json:"height"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type tiledJSONTileset struct {
+	FirstGID    int                  `json:"firstgid,omitempty"`
+	Source      string               `json:"source,omitempty"`
+	Type        string               `json:"type,omitempty"`
+	Version     string               `json:"version,omitempty"`
+	Name        string               `json:"name,omitempty"`
+	Image       string               `json:"image,omitempty"`
+	ImageWidth  int                  `json:"imagewidth,omitempty"`
+	ImageHeight int                  `json:"imageheight,omitempty"`
+	TileWidth   int                  `json:"tilewidth,omitempty"`
+	TileHeight  int                  `json:"tileheight,omitempty"`
+	Spacing     int                  `json:"spacing"`
+	Margin      int                  `json:"margin"`
+	TileCount   int                  `json:"tilecount,omitempty"`
+	Columns     int                  `json:"columns,omitempty"`
+	TileOffset  *tiledJSONTileOffset `json:"tileoffset,omitempty"`
+	Tiles       []tiledJSONTile      `json:"tiles,omitempty"`
+}
+
+type tiledJSONTileOffset struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type tiledJSONTile struct {
+	ID         int                 `json:"id"`
+	Properties []tiledJSONProperty `json:"properties,omitempty"`
+	Animation  []tiledJSONFrame    `json:"animation,omitempty"`
+}
+
+type tiledJSONFrame struct {
+	TileID   int `json:"tileid"`
+	Duration int `json:"duration"`
+}
+
+type tiledJSONProperty struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// jsonGIDs decodes layer data that is either an array of gids or an encoded string
+func jsonGIDs(encoding, compression string, data json.RawMessage, n int) ([]uint32, error) {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, err
+		}
+		return decodeGIDs(encoding, compression, s, n)
+	}
+	var gids []uint32
+	err := json.Unmarshal(data, &gids)
+	return gids, err
+}
+
+func ReadTiledJSON(r io.Reader, dir string) (*Map, error) {
+	var doc tiledJSONMap
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	grid, shift, err := tiledGrid(doc.Orientation, doc.StaggerAxis, doc.StaggerIndex)
+	if err != nil {
+		return nil, err
+	}
+	tm := &tiledMap{tileWidth: doc.TileWidth, tileHeight: doc.TileHeight, grid: grid, shift: shift}
+	for _, t := range doc.Tilesets {
+		ts, err := readJSONTileset(t, dir)
+		if err != nil {
+			return nil, err
+		}
+		tm.tilesets = append(tm.tilesets, ts)
+	}
+	if err := tm.readJSONLayers(doc.Layers); err != nil {
+		return nil, err
+	}
+	return tm.build()
+}
+
+func (tm *tiledMap) readJSONLayers(layers []tiledJSONLayer) error {
+	for _, l := range layers {
+		switch l.Type {
+		case "group":
+			if err := tm.readJSONLayers(l.Layers); err != nil {
+				return err
+			}
+		case "tilelayer":
+			layer := &tiledLayer{name: l.Name, visible: l.Visible, locked: l.Locked, opacity: l.Opacity}
+			if len(l.Chunks) > 0 {
+				for _, c := range l.Chunks {
+					gids, err := jsonGIDs(l.Encoding, l.Compression, c.Data, c.Width*c.Height)
+					if err != nil {
+						return fmt.Errorf("layer %q: %w", l.Name, err)
+					}
+					layer.chunks = append(layer.chunks, tiledChunk{x: c.X, y: c.Y, width: c.Width, height: c.Height, gids: gids})
+				}
+			} else {
+				gids, err := jsonGIDs(l.Encoding, l.Compression, l.Data, l.Width*l.Height)
+				if err != nil {
+					return fmt.Errorf("layer %q: %w", l.Name, err)
+				}
+				layer.chunks = append(layer.chunks, tiledChunk{x: l.X, y: l.Y, width: l.Width, height: l.Height, gids: gids})
+			}
+			tm.layers = append(tm.layers, layer)
+		}
+	}
+	return nil
+}
+
+func readJSONTileset(t tiledJSONTileset, dir string) (*tiledTileset, error) {
+	if t.Source != "" {
+		return readTMXTileset(tmxTileset{FirstGID: t.FirstGID, Source: t.Source}, dir)
+	}
+	ts := &tiledTileset{
+		firstGID:    t.FirstGID,
+		name:        t.Name,
+		image:       resolvePath(dir, t.Image),
+		imageWidth:  t.ImageWidth,
+		imageHeight: t.ImageHeight,
+		tileWidth:   t.TileWidth,
+		tileHeight:  t.TileHeight,
+		spacing:     t.Spacing,
+		margin:      t.Margin,
+		count:       t.TileCount,
+		columns:     t.Columns,
+	}
+	if t.TileOffset != nil {
+		ts.offsetX, ts.offsetY = t.TileOffset.X, t.TileOffset.Y
+	}
+	for _, tile := range t.Tiles {
+		for _, prop := range tile.Properties {
+			ts.setTiledProperty(tile.ID, prop.Name, prop.Value)
+		}
+		var a Animation
+		for _, f := range tile.Animation {
+			a = append(a, Frame{Index: f.TileID, Duration: f.Duration})
+		}
+		ts.setTiledAnimation(tile.ID, a)
+	}
+	return ts, nil
+}
+
+// readTSJ reads an external Tiled tileset in JSON format, resolving its image relative to dir
+func readTSJ(r io.Reader, dir string) (*tiledTileset, error) {
+	var t tiledJSONTileset
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return nil, err
+	}
+	t.Source = ""
+	return readJSONTileset(t, dir)
+}
+
+func WriteTiledJSON(w io.Writer, m *Map, dir string) error {
+	tm, width, height := newTiledMap(m, dir)
+	doc := tiledJSONMap{
+		Type:         "map",
+		Version:      "1.10",
+		RenderOrder:  "right-down",
+		Width:        width,
+		Height:       height,
+		TileWidth:    tm.tileWidth,
+		TileHeight:   tm.tileHeight,
+		NextLayerID:  len(tm.layers) + 1,
+		NextObjectID: 1,
+		Layers:       []tiledJSONLayer{},
+		Tilesets:     []tiledJSONTileset{},
+	}
+	doc.Orientation, doc.StaggerAxis, doc.StaggerIndex, doc.HexSideLength = tm.orientation()
+	for _, ts := range tm.tilesets {
+		var tiles []tiledJSONTile
+		for _, id := range ts.tileIDs() {
+			tile := tiledJSONTile{ID: id}
+			tiledProperties(ts.properties[id], func(name, typ string, value interface{}) {
+				tile.Properties = append(tile.Properties, tiledJSONProperty{Name: name, Type: typ, Value: value})
+			})
+			for _, f := range ts.animations[id] {
+				tile.Animation = append(tile.Animation, tiledJSONFrame{TileID: f.Index, Duration: f.Duration})
+			}
+			tiles = append(tiles, tile)
+		}
+		var offset *tiledJSONTileOffset
+		if ts.offsetX != 0 || ts.offsetY != 0 {
+			offset = &tiledJSONTileOffset{X: ts.offsetX, Y: ts.offsetY}
+		}
+		doc.Tilesets = append(doc.Tilesets, tiledJSONTileset{
+			FirstGID:    ts.firstGID,
+			Name:        ts.name,
+			Image:       ts.image,
+			ImageWidth:  ts.imageWidth,
+			ImageHeight: ts.imageHeight,
+			TileWidth:   ts.tileWidth,
+			TileHeight:  ts.tileHeight,
+			Spacing:     ts.spacing,
+			Margin:      ts.margin,
+			TileCount:   ts.count,
+			Columns:     ts.columns,
+			TileOffset:  offset,
+			Tiles:       tiles,
+		})
+	}
+	for i, layer := range tm.layers {
+		data, err := json.Marshal(layer.chunks[0].gids)
+		if err != nil {
+			return err
+		}
+		doc.Layers = append(doc.Layers, tiledJSONLayer{
+			ID:      i + 1,
+			Name:    layer.name,
+			Type:    "tilelayer",
+			Width:   width,
+			Height:  height,
+			Opacity: layer.opacity,
+			Visible: layer.visible,
+			Locked:  layer.locked,
+			Data:    data,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func tiledSample() *Map {
+	ts := NewTileset()
+	ts.Spritesheets["maps/a.png"] = &Spritesheet{Name: "maps/a.png", TileWidth: 16, TileHeight: 16, Spacing: 1, Width: 4, Height: 4}
+	ts.Spritesheets["maps/b.png"] = &Spritesheet{Name: "maps/b.png", TileWidth: 16, TileHeight: 16, Margin: 2, Width: 2, Height: 3}
+	ts.Spritesheets["maps/a.png"].SetWalkable(15, false)
+	ts.Spritesheets["maps/a.png"].EditProperties(15).SetTags([]string{"wall", "stone"})
+	ts.Spritesheets["maps/b.png"].EditProperties(5).Set("weight", 0.5)
+	ts.Spritesheets["maps/b.png"].EditProperties(5).Set("name", "chest")
+	ts.Spritesheets["maps/a.png"].SetAnimation(4, Animation{{Index: 4, Duration: 150}, {Index: 5, Duration: 150}, {Index: 6, Duration: 300}})
+	m := NewMap(16, 16, ts)
+	ground := m.Layer("Layer 1")
+	ground.Name = "ground"
+	decor := m.AddLayer("decor")
+	decor.Visible, decor.Locked, decor.Opacity = false, true, 0.5
+	ground.Tilemap.Put(Stack{{Spritesheet: "maps/a.png", Index: 0}}, 0, 0)
+	decor.Tilemap.Put(Stack{{Spritesheet: "maps/b.png", Index: 5, Flip: FlipHorizontal | FlipDiagonal}}, 0, 0)
+	ground.Tilemap.Put(Stack{{Spritesheet: "maps/a.png", Index: 15, Flip: FlipVertical}}, 2, 1)
+	return m
+}
+
+func TestTiledRoundTrip(t *testing.T) {
+	for _, format := range []struct {
+		name  string
+		write func(io.Writer, *Map, string) error
+		read  func(io.Reader, string) (*Map, error)
+	}{
+		{"tmx", WriteTMX, ReadTMX},
+		{"json", WriteTiledJSON, ReadTiledJSON},
+	} {
+		m := tiledSample()
+		buf := new(bytes.Buffer)
+		if err := format.write(buf, m, "maps"); err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+		got, err := format.read(buf, "maps")
+		if err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+		for name, sheet := range m.Spritesheets {
+			if !reflect.DeepEqual(got.Spritesheets[name], sheet) {
+				t.Fatalf("%s: wrong spritesheet %s, got %+v, want %+v", format.name, name, got.Spritesheets[name], sheet)
+			}
+		}
+		if g, w := len(got.Layers), len(m.Layers); g != w {
+			t.Fatalf("%s: wrong number of layers, got %d, want %d", format.name, g, w)
+		}
+		for i, l := range m.Layers {
+			gl := got.Layers[i]
+			if gl.Name != l.Name || gl.Visible != l.Visible || gl.Locked != l.Locked || gl.Opacity != l.Opacity {
+				t.Fatalf("%s: wrong layer, got %+v, want %+v", format.name, gl, l)
+			}
+			for _, p := range [][2]int{{0, 0}, {2, 1}, {1, 1}} {
+				if g, w := gl.Tilemap.Get(p[0], p[1]).Hash(), l.Tilemap.Get(p[0], p[1]).Hash(); g != w {
+					t.Fatalf("%s: wrong stack in %s at %v, got %q, want %q", format.name, l.Name, p, g, w)
+				}
+			}
+		}
+	}
+}
+
+func TestReadTMXBase64(t *testing.T) {
+	gids := []uint32{0, 2, 0x80000000 | 3, 0}
+	raw := new(bytes.Buffer)
+	binary.Write(raw, binary.LittleEndian, gids)
+	compressed := new(bytes.Buffer)
+	z := zlib.NewWriter(compressed)
+	z.Write(raw.Bytes())
+	z.Close()
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.10" orientation="orthogonal" width="2" height="2" tilewidth="8" tileheight="8">
+ <tileset firstgid="2" name="t" tilewidth="8" tileheight="8" tilecount="4" columns="2">
+  <image source="t.png" width="16" height="16"/>
+ </tileset>
+ <layer id="1" name="ground" width="2" height="2">
+  <data encoding="base64" compression="zlib">` + base64.StdEncoding.EncodeToString(compressed.Bytes()) + `</data>
+ </layer>
+</map>`
+	m, err := ReadTMX(strings.NewReader(doc), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := m.Layer("ground")
+	if l == nil {
+		t.Fatal("expected ground layer")
+	}
+	if got, want := l.Tilemap.Get(1, 0).Hash(), (&Tile{Spritesheet: "t.png", Index: 0}).Hash(); got != want {
+		t.Fatalf("wrong tile, got %q, want %q", got, want)
+	}
+	if got, want := l.Tilemap.Get(0, 1).Hash(), (&Tile{Spritesheet: "t.png", Index: 1, Flip: FlipHorizontal}).Hash(); got != want {
+		t.Fatalf("wrong tile, got %q, want %q", got, want)
+	}
+	if len(l.Tilemap.Get(0, 0)) != 0 {
+		t.Fatalf("expected empty cell, got %q", l.Tilemap.Get(0, 0).Hash())
+	}
+}
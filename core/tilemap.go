@@ -0,0 +1,378 @@
+// Package core is the map model and generators behind weave, independent of any rendering
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+)
+
+// Tile identifies a single tile by its spritesheet and index within that spritesheet
+type Tile struct {
+	Spritesheet string
+	Index       int
+	Flip        Flip `json:",omitempty"`
+}
+
+func (t *Tile) Hash() string {
+	if t == nil {
+		return ""
+	}
+	if t.Flip != 0 {
+		return fmt.Sprintf("%s:%d:%d", t.Spritesheet, t.Index, t.Flip)
+	}
+	return fmt.Sprintf("%s:%d", t.Spritesheet, t.Index)
+}
+
+// Flip mirrors how a tile is drawn, as in Tiled the diagonal flip is applied first, then horizontal, then vertical
+type Flip uint8
+
+const (
+	FlipHorizontal = Flip(1 << iota)
+	FlipVertical
+	FlipDiagonal
+)
+
+// Transform maps the pixel at x, y of a w x h tile to where it is drawn once flipped
+func (f Flip) Transform(x, y, w, h int) (int, int) {
+	if f&FlipDiagonal != 0 {
+		x, y = y, x
+		w, h = h, w
+	}
+	if f&FlipHorizontal != 0 {
+		x = w - 1 - x
+	}
+	if f&FlipVertical != 0 {
+		y = h - 1 - y
+	}
+	return x, y
+}
+
+type Stack []*Tile
+
+func (s Stack) Hash() string {
+	a := make([]string, len(s))
+	for i, t := range s {
+		a[i] = t.Hash()
+	}
+	return strings.Join(a, ",")
+}
+
+// equal is true if s and o hold the same tiles
+func (s Stack) equal(o Stack) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for i := range s {
+		if (s[i] == nil) != (o[i] == nil) || s[i] != nil && *s[i] != *o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Stack) Clone() Stack {
+	if len(s) == 0 {
+		return nil
+	}
+	return append(Stack(nil), s...)
+}
+
+// ChunkSize is the width and height in cells of the chunks a Tilemap stores its cells in
+const ChunkSize = 1 << chunkShift
+
+const chunkShift = 4
+
+// Tilemap holds a stack of tiles per cell in dense chunks keyed by their coordinates. Stacks read from it are shared
+// and must not be modified.
+type Tilemap map[image.Point]*chunk
+
+type chunk struct {
+	cells [ChunkSize * ChunkSize]stackID
+	// stacks are the stacks of the cells by ID less one, and any no longer used since the chunk was compacted
+	stacks []Stack
+	// count is the number of non-empty cells
+	count int
+}
+
+// stackID identifies a stack within a chunk, the empty stack is always 0
+type stackID uint16
+
+// maxStacks is how many stacks a chunk keeps before dropping those no longer used
+const maxStacks = 2 * ChunkSize * ChunkSize
+
+// intern returns the ID of s within c, adding a copy of it if c doesn't have it yet
+func (c *chunk) intern(s Stack) stackID {
+	if len(s) == 0 {
+		return 0
+	}
+	for i, stack := range c.stacks {
+		if stack.equal(s) {
+			return stackID(i + 1)
+		}
+	}
+	if len(c.stacks) >= maxStacks {
+		c.compact()
+	}
+	tiles := make([]Tile, len(s))
+	stack := make(Stack, len(s))
+	for i, t := range s {
+		if t != nil {
+			tiles[i] = *t
+			stack[i] = &tiles[i]
+		}
+	}
+	c.stacks = append(c.stacks, stack)
+	return stackID(len(c.stacks))
+}
+
+// compact drops the stacks no cell holds any more
+func (c *chunk) compact() {
+	ids := make(map[stackID]stackID)
+	var stacks []Stack
+	for i, id := range c.cells {
+		if id == 0 {
+			continue
+		}
+		if _, ok := ids[id]; !ok {
+			stacks = append(stacks, c.stacks[id-1])
+			ids[id] = stackID(len(stacks))
+		}
+		c.cells[i] = ids[id]
+	}
+	c.stacks = stacks
+}
+
+func (c *chunk) stack(i int) Stack {
+	if c.cells[i] == 0 {
+		return nil
+	}
+	return c.stacks[c.cells[i]-1]
+}
+
+// chunkOf returns the chunk holding the cell at x, y and the cell's index within it
+func chunkOf(x, y int) (image.Point, int) {
+	return image.Pt(x>>chunkShift, y>>chunkShift), (y&(ChunkSize-1))*ChunkSize + x&(ChunkSize-1)
+}
+
+// ChunkRect returns the cells of the chunk at c
+func ChunkRect(c image.Point) image.Rectangle {
+	return image.Rect(c.X*ChunkSize, c.Y*ChunkSize, (c.X+1)*ChunkSize, (c.Y+1)*ChunkSize)
+}
+
+// Get returns the stack at x, y, which must not be modified
+func (m Tilemap) Get(x, y int) Stack {
+	p, i := chunkOf(x, y)
+	c := m[p]
+	if c == nil {
+		return nil
+	}
+	return c.stack(i)
+}
+
+// Put replaces the entire stack at x, y, removing the cell if the stack is empty
+func (m Tilemap) Put(stack Stack, x, y int) {
+	p, i := chunkOf(x, y)
+	c := m[p]
+	if c == nil {
+		if len(stack) == 0 {
+			return
+		}
+		c = new(chunk)
+		m[p] = c
+	}
+	id := c.intern(stack)
+	if c.cells[i] == 0 && id != 0 {
+		c.count++
+	} else if c.cells[i] != 0 && id == 0 {
+		c.count--
+	}
+	c.cells[i] = id
+	if c.count == 0 {
+		delete(m, p)
+	}
+}
+
+func (m Tilemap) Set(tile *Tile, x, y int, replace bool, z int) {
+	stack := m.Get(x, y).Clone()
+	l := len(stack)
+	if l == 0 {
+		// first tile in the stack
+		stack = Stack{tile}
+	} else if z >= l {
+		// append
+		stack = append(stack, tile)
+	} else if replace {
+		// replace
+		stack[z] = tile
+	} else {
+		// insert
+		stack = append(stack[:z+1], stack[z:]...)
+		stack[z] = tile
+	}
+	m.Put(stack, x, y)
+}
+
+func (m Tilemap) At(x, y, z int) *Tile {
+	stack := m.Get(x, y)
+	if z < 0 || z >= len(stack) {
+		return nil
+	}
+	return stack[z]
+}
+
+// Chunks lists the chunks holding any cells, from the top down and left to right
+func (m Tilemap) Chunks() []image.Point {
+	chunks := make([]image.Point, 0, len(m))
+	for p := range m {
+		chunks = append(chunks, p)
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		if chunks[i].Y != chunks[j].Y {
+			return chunks[i].Y < chunks[j].Y
+		}
+		return chunks[i].X < chunks[j].X
+	})
+	return chunks
+}
+
+// Occupied is true if the chunk at c holds any cells
+func (m Tilemap) Occupied(c image.Point) bool {
+	return m[c] != nil
+}
+
+// Each calls f with every non-empty cell, a chunk at a time in the order of Chunks, and row by row within each chunk.
+// f may Put cells of m.
+func (m Tilemap) Each(f func(x, y int, stack Stack)) {
+	for _, p := range m.Chunks() {
+		c := m[p]
+		if c == nil {
+			continue
+		}
+		for i := range c.cells {
+			if stack := c.stack(i); stack != nil {
+				f(p.X*ChunkSize+i%ChunkSize, p.Y*ChunkSize+i/ChunkSize, stack)
+			}
+		}
+	}
+}
+
+// Len returns the number of non-empty cells
+func (m Tilemap) Len() int {
+	var n int
+	for _, c := range m {
+		n += c.count
+	}
+	return n
+}
+
+// Bounds returns the smallest rectangle containing every non-empty cell
+func (m Tilemap) Bounds() image.Rectangle {
+	var bounds image.Rectangle
+	for p, c := range m {
+		// only scan chunks that could extend the bounds
+		if r := ChunkRect(p); !bounds.Empty() && r.In(bounds) {
+			continue
+		}
+		for i, id := range c.cells {
+			if id == 0 {
+				continue
+			}
+			x, y := p.X*ChunkSize+i%ChunkSize, p.Y*ChunkSize+i/ChunkSize
+			cell := image.Rect(x, y, x+1, y+1)
+			if bounds.Empty() {
+				bounds = cell
+			} else {
+				bounds = bounds.Union(cell)
+			}
+		}
+	}
+	return bounds
+}
+
+// Sub returns the cells of m within rect, keeping their coordinates
+func (m Tilemap) Sub(rect image.Rectangle) Tilemap {
+	sub := make(Tilemap)
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			if stack := m.Get(x, y); len(stack) > 0 {
+				sub.Put(stack, x, y)
+			}
+		}
+	}
+	return sub
+}
+
+// tilemapJSON is how a Tilemap is saved, each cell is 0 if empty or one more than the index of its stack
+type tilemapJSON struct {
+	Stacks []Stack
+	Chunks []chunkJSON
+}
+
+type chunkJSON struct {
+	X, Y  int
+	Cells []int
+}
+
+func (m Tilemap) MarshalJSON() ([]byte, error) {
+	data := tilemapJSON{Chunks: []chunkJSON{}}
+	index := make(map[string]int)
+	for _, p := range m.Chunks() {
+		c := chunkJSON{X: p.X, Y: p.Y, Cells: make([]int, len(m[p].cells))}
+		for i := range m[p].cells {
+			stack := m[p].stack(i)
+			if stack == nil {
+				continue
+			}
+			h := stack.Hash()
+			if _, ok := index[h]; !ok {
+				data.Stacks = append(data.Stacks, stack)
+				index[h] = len(data.Stacks)
+			}
+			c.Cells[i] = index[h]
+		}
+		data.Chunks = append(data.Chunks, c)
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON decodes a saved Tilemap, or one saved before chunks existed as cells nested by x and then y
+func (m *Tilemap) UnmarshalJSON(buf []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return err
+	}
+	*m = make(Tilemap)
+	if _, ok := fields["Chunks"]; !ok {
+		var legacy map[int]map[int]Stack
+		if err := json.Unmarshal(buf, &legacy); err != nil {
+			return err
+		}
+		for x, ys := range legacy {
+			for y, stack := range ys {
+				m.Put(stack, x, y)
+			}
+		}
+		return nil
+	}
+	var data tilemapJSON
+	if err := json.Unmarshal(buf, &data); err != nil {
+		return err
+	}
+	for _, c := range data.Chunks {
+		if len(c.Cells) != ChunkSize*ChunkSize {
+			return fmt.Errorf("chunk %d, %d has %d cells, want %d", c.X, c.Y, len(c.Cells), ChunkSize*ChunkSize)
+		}
+		for i, s := range c.Cells {
+			if s < 0 || s > len(data.Stacks) {
+				return fmt.Errorf("chunk %d, %d has unknown stack %d", c.X, c.Y, s)
+			}
+			if s > 0 {
+				m.Put(data.Stacks[s-1], c.X*ChunkSize+i%ChunkSize, c.Y*ChunkSize+i/ChunkSize)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"testing"
+)
+
+func TestTilemapChunks(t *testing.T) {
+	m := make(Tilemap)
+	cells := [][2]int{{0, 0}, {-1, -1}, {15, 16}, {-17, 3}, {40, -2}}
+	for i, c := range cells {
+		m.Set(&Tile{Spritesheet: "a", Index: i}, c[0], c[1], true, 0)
+	}
+	m.Set(&Tile{Spritesheet: "b"}, 0, 0, false, 0)
+	if got, want := m.Get(0, 0).Hash(), "b:0,a:0"; got != want {
+		t.Fatalf("wrong stack, got %q, want %q", got, want)
+	}
+	if got, want := m.Get(-1, -1).Hash(), "a:1"; got != want {
+		t.Fatalf("wrong stack, got %q, want %q", got, want)
+	}
+	if got, want := m.Len(), len(cells); got != want {
+		t.Fatalf("wrong number of cells, got %d, want %d", got, want)
+	}
+	if got, want := m.Bounds(), image.Rect(-17, -2, 41, 17); got != want {
+		t.Fatalf("wrong bounds, got %v, want %v", got, want)
+	}
+	var order [][2]int
+	m.Each(func(x, y int, stack Stack) {
+		order = append(order, [2]int{x, y})
+	})
+	want := [][2]int{{-1, -1}, {40, -2}, {-17, 3}, {0, 0}, {15, 16}}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("wrong order, got %v, want %v", order, want)
+		}
+	}
+	// emptying a chunk removes it
+	m.Put(nil, 40, -2)
+	if m.Occupied(image.Pt(2, -1)) || len(m) != 4 {
+		t.Fatalf("expected chunk to be removed, got %v", m.Chunks())
+	}
+}
+
+func TestTilemapStacks(t *testing.T) {
+	m := make(Tilemap)
+	m.Put(Stack{{Spritesheet: "a"}}, 1, 1)
+	// stacks no cell holds are dropped, however many are put
+	for i := 0; i < 10*maxStacks; i++ {
+		m.Put(Stack{{Spritesheet: "a", Index: i}, nil}, 0, 0)
+	}
+	if c := m[image.Pt(0, 0)]; len(c.stacks) > maxStacks {
+		t.Fatalf("expected at most %d stacks, got %d", maxStacks, len(c.stacks))
+	}
+	if got, want := m.Get(0, 0).Hash(), fmt.Sprintf("a:%d,", 10*maxStacks-1); got != want {
+		t.Fatalf("wrong stack, got %q, want %q", got, want)
+	}
+	if got, want := m.Get(1, 1).Hash(), "a:0"; got != want {
+		t.Fatalf("wrong stack, got %q, want %q", got, want)
+	}
+	tile := &Tile{Spritesheet: "b"}
+	m.Put(Stack{tile}, 2, 2)
+	m.Put(Stack{{Spritesheet: "b"}}, 3, 2)
+	if tile.Index = 1; m.Get(2, 2)[0] != m.Get(3, 2)[0] || m.Get(2, 2)[0].Index != 0 {
+		t.Fatal("expected identical stacks to be shared and copied")
+	}
+}
+
+func TestTilemapJSON(t *testing.T) {
+	m := make(Tilemap)
+	m.Put(Stack{{Spritesheet: "a", Index: 1}, {Spritesheet: "a", Index: 2, Flip: FlipVertical}}, 3, -20)
+	m.Put(Stack{{Spritesheet: "a", Index: 1}}, 17, 4)
+	m.Put(Stack{{Spritesheet: "a", Index: 1}}, 18, 4)
+	buf, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != string(again) {
+		t.Fatalf("tilemap saved differently twice")
+	}
+	var loaded Tilemap
+	if err := json.Unmarshal(buf, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range [][2]int{{3, -20}, {17, 4}, {18, 4}, {0, 0}} {
+		if got, want := loaded.Get(c[0], c[1]).Hash(), m.Get(c[0], c[1]).Hash(); got != want {
+			t.Fatalf("wrong stack at %v, got %q, want %q", c, got, want)
+		}
+	}
+	// tilemaps saved before chunks nest their cells by x and then y
+	var legacy Tilemap
+	if err := json.Unmarshal([]byte(`{"3":{"-20":[{"Spritesheet":"a","Index":1}]},"4":{}}`), &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := legacy.Get(3, -20).Hash(), "a:1"; got != want || legacy.Len() != 1 {
+		t.Fatalf("wrong legacy stack, got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,279 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"os"
+
+	_ "image/png"
+)
+
+type Tileset struct {
+	Spritesheets map[string]*Spritesheet
+	tiles        []*Tile
+}
+
+func NewTileset() *Tileset {
+	return &Tileset{
+		Spritesheets: make(map[string]*Spritesheet),
+	}
+}
+
+// Add loads sheet, registering it under its name
+func (ts *Tileset) Add(sheet *Spritesheet) error {
+	if err := sheet.Load(); err != nil {
+		return err
+	}
+	ts.Spritesheets[sheet.Name] = sheet
+	ts.tiles = nil
+	return nil
+}
+
+// Remove drops the named spritesheet, tiles from it are dropped from maps when they're cleaned up
+func (ts *Tileset) Remove(name string) {
+	delete(ts.Spritesheets, name)
+	ts.tiles = nil
+}
+
+// Load reads the image of every spritesheet, e.g. after decoding a tileset from JSON
+func (ts *Tileset) Load() error {
+	for _, sheet := range ts.Spritesheets {
+		if sheet.Image != nil {
+			continue
+		}
+		img, err := loadImage(sheet.File())
+		if err != nil {
+			return err
+		}
+		sheet.Image = img
+	}
+	return nil
+}
+
+func (ts *Tileset) Tiles() []*Tile {
+	if ts.tiles != nil {
+		return ts.tiles
+	}
+	var tiles []*Tile
+	for name, sheet := range ts.Spritesheets {
+		for i := 0; i < sheet.Len(); i++ {
+			tiles = append(tiles, &Tile{
+				Spritesheet: name,
+				Index:       i,
+			})
+		}
+	}
+	ts.tiles = tiles
+	return tiles
+}
+
+// SubImage returns the part of its spritesheet showing t, or nil if it isn't in the tileset
+func (ts *Tileset) SubImage(t *Tile) image.Image {
+	if t == nil {
+		return nil
+	}
+	return ts.Spritesheets[t.Spritesheet].SubImage(t.Index)
+}
+
+// Offset is how far t is moved from its cell when drawn, in pixels
+func (ts *Tileset) Offset(t *Tile) image.Point {
+	if sheet := ts.Spritesheets[t.Spritesheet]; sheet != nil {
+		return image.Pt(sheet.OffsetX, sheet.OffsetY)
+	}
+	return image.Point{}
+}
+
+// Spritesheet is the geometry of a grid of equally sized tiles in a single image
+type Spritesheet struct {
+	// Name is what tiles call the spritesheet by, and its image file unless it has a Path
+	Name string
+	// Path is the image file, e.g. when the spritesheet is loaded from a manifest elsewhere, see LoadManifest
+	Path                  string      `json:",omitempty"`
+	Image                 image.Image `json:"-"`
+	TileWidth, TileHeight int
+	// Spacing is the pixels between tiles, and Margin those around them all
+	Spacing int
+	Margin  int `json:",omitempty"`
+	// OffsetX, OffsetY moves every tile from its cell when drawn, in pixels
+	OffsetX, OffsetY int `json:",omitempty"`
+	// Width, Height are the columns and rows of tiles, fit to the image if they're 0 when it's loaded
+	Width, Height int
+	// Symmetries is the symmetry class of tiles by index, see Analysis.Expand
+	Symmetries map[int]Symmetry `json:",omitempty"`
+	// Animations are the frames of animated tiles by index, see Animation
+	Animations map[int]Animation `json:",omitempty"`
+	// Sockets labels the edges of tiles by index, kept in a sidecar file, see AnalyzeSockets
+	Sockets map[int]Socket `json:"-"`
+	// Properties are the tags and values of tiles by index, kept in a sidecar file, see Properties
+	Properties map[int]*Properties `json:"-"`
+}
+
+// NewSpritesheet cuts img into as many tileWidth x tileHeight tiles as fit, spacing pixels apart within margin
+func NewSpritesheet(name string, img image.Image, tileWidth, tileHeight, spacing, margin int) *Spritesheet {
+	s := &Spritesheet{
+		Name:       name,
+		Image:      img,
+		TileWidth:  tileWidth,
+		TileHeight: tileHeight,
+		Spacing:    spacing,
+		Margin:     margin,
+	}
+	s.fit()
+	return s
+}
+
+// UnmarshalJSON decodes a spritesheet, including those saved with a single Size before tiles could be non-square
+func (s *Spritesheet) UnmarshalJSON(buf []byte) error {
+	type spritesheet Spritesheet
+	var legacy struct{ Size int }
+	if err := json.Unmarshal(buf, &legacy); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(buf, (*spritesheet)(s)); err != nil {
+		return err
+	}
+	if s.TileWidth == 0 && s.TileHeight == 0 {
+		s.TileWidth, s.TileHeight = legacy.Size, legacy.Size
+	}
+	return nil
+}
+
+// File is the spritesheet's image file
+func (s *Spritesheet) File() string {
+	if s.Path != "" {
+		return s.Path
+	}
+	return s.Name
+}
+
+// Load reads the spritesheet's image, fitting its columns and rows to it unless they're known, along with its
+// sidecar files
+func (s *Spritesheet) Load() error {
+	if s.TileWidth <= 0 || s.TileHeight <= 0 {
+		return fmt.Errorf("%s: tiles of %dx%d", s.Name, s.TileWidth, s.TileHeight)
+	}
+	if s.Image == nil {
+		img, err := loadImage(s.File())
+		if err != nil {
+			return err
+		}
+		s.Image = img
+	}
+	if s.Width == 0 || s.Height == 0 {
+		s.fit()
+	}
+	if err := s.LoadSockets(); err != nil {
+		return err
+	}
+	return s.LoadProperties()
+}
+
+// fit sets the columns and rows to as many tiles as the image holds, the way Tiled counts them, so the last column
+// and row needn't be followed by spacing or margin
+func (s *Spritesheet) fit() {
+	b := s.Image.Bounds()
+	s.Width = max(0, (b.Dx()-s.Margin+s.Spacing)/(s.TileWidth+s.Spacing))
+	s.Height = max(0, (b.Dy()-s.Margin+s.Spacing)/(s.TileHeight+s.Spacing))
+}
+
+func loadImage(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// Symmetry is the class of the tile at index
+func (s *Spritesheet) Symmetry(index int) Symmetry {
+	if s == nil {
+		return SymmetryNone
+	}
+	return s.Symmetries[index]
+}
+
+// SetSymmetry sets the class of the tile at index
+func (s *Spritesheet) SetSymmetry(index int, class Symmetry) {
+	if class == SymmetryNone {
+		delete(s.Symmetries, index)
+		return
+	}
+	if s.Symmetries == nil {
+		s.Symmetries = make(map[int]Symmetry)
+	}
+	s.Symmetries[index] = class
+}
+
+// Walkable is false if the tile at index blocks the way, by its "walkable" property
+func (s *Spritesheet) Walkable(index int) bool {
+	return s != nil && s.TileProperties(index).Bool("walkable", true)
+}
+
+// SetWalkable sets whether the tile at index can be walked over
+func (s *Spritesheet) SetWalkable(index int, walkable bool) {
+	if walkable {
+		s.EditProperties(index).Set("walkable", nil)
+		s.cleanupProperties()
+		return
+	}
+	s.EditProperties(index).Set("walkable", false)
+}
+
+// Walkable is false if t blocks the way, or isn't in the tileset
+func (ts *Tileset) Walkable(t *Tile) bool {
+	return ts != nil && t != nil && ts.Spritesheets[t.Spritesheet].Walkable(t.Index)
+}
+
+// Len is the number of tiles in the spritesheet
+func (s *Spritesheet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return s.Width * s.Height
+}
+
+// Cell is the column and row of the tile at x, y in the image, which may be outside the spritesheet
+func (s *Spritesheet) Cell(x, y int) image.Point {
+	return image.Pt(
+		int(math.Floor(float64(x-s.Margin)/float64(s.TileWidth+s.Spacing))),
+		int(math.Floor(float64(y-s.Margin)/float64(s.TileHeight+s.Spacing))))
+}
+
+// TileAt is the index of the tile at x, y in the image, or -1 if there isn't one
+func (s *Spritesheet) TileAt(x, y int) int {
+	if s == nil {
+		return -1
+	}
+	p := s.Cell(x, y)
+	if !p.In(image.Rect(0, 0, s.Width, s.Height)) {
+		return -1
+	}
+	return p.Y*s.Width + p.X
+}
+
+func (s *Spritesheet) Rect(index int) *image.Rectangle {
+	if s == nil || index < 0 || s.Width <= 0 {
+		return nil
+	}
+	x := s.Margin + (index%s.Width)*(s.TileWidth+s.Spacing)
+	y := s.Margin + (index/s.Width)*(s.TileHeight+s.Spacing)
+	rect := image.Rect(x, y, x+s.TileWidth, y+s.TileHeight)
+	return &rect
+}
+
+func (s *Spritesheet) SubImage(index int) image.Image {
+	if s == nil || s.Image == nil || index < 0 || index >= s.Len() {
+		return nil
+	}
+	img, ok := s.Image.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil
+	}
+	return img.SubImage(s.Rect(index).Add(s.Image.Bounds().Min))
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSpritesheet(t *testing.T) {
+	// two 16x16 tiles per row with 1px of spacing between them
+	img := image.NewRGBA(image.Rect(0, 0, 33, 33))
+	img.Set(17, 17, color.White)
+	s := NewSpritesheet("test.png", img, 16, 16, 1, 0)
+	if got, want := s.Len(), 4; got != want {
+		t.Fatalf("wrong number of tiles, got %d, want %d", got, want)
+	}
+	if got, want := *s.Rect(3), image.Rect(17, 17, 33, 33); got != want {
+		t.Fatalf("wrong rect, got %v, want %v", got, want)
+	}
+	if got, want := s.SubImage(3).Bounds(), image.Rect(17, 17, 33, 33); got != want {
+		t.Fatalf("wrong sub image bounds, got %v, want %v", got, want)
+	}
+	if s.SubImage(4) != nil {
+		t.Fatal("expected nil sub image for out of range index")
+	}
+}
+
+func TestRender(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 33, 33))
+	img.Set(17, 17, color.White)
+	ts := NewTileset()
+	ts.Spritesheets["test.png"] = NewSpritesheet("test.png", img, 16, 16, 1, 0)
+	m := make(Tilemap)
+	m.Set(&Tile{Spritesheet: "test.png", Index: 3}, 1, 0, false, 0)
+	dst := Render(m, ts, image.Rect(0, 0, 2, 1), 16, 16)
+	if got, want := dst.Bounds(), image.Rect(0, 0, 32, 16); got != want {
+		t.Fatalf("wrong bounds, got %v, want %v", got, want)
+	}
+	if got, want := dst.RGBAAt(16, 0), (color.RGBA{255, 255, 255, 255}); got != want {
+		t.Fatalf("wrong pixel, got %v, want %v", got, want)
+	}
+	if got, want := dst.RGBAAt(0, 0), (color.RGBA{}); got != want {
+		t.Fatalf("wrong pixel, got %v, want %v", got, want)
+	}
+}
+
+func TestWalkable(t *testing.T) {
+	ts := NewTileset()
+	ts.Spritesheets["a"] = &Spritesheet{Name: "a", TileWidth: 16, TileHeight: 16, Width: 4, Height: 4}
+	ts.Spritesheets["a"].SetWalkable(2, false)
+	m := NewMap(16, 16, ts)
+	walls := m.AddLayer("walls").Tilemap
+	for x := 0; x < 3; x++ {
+		m.Layer("Layer 1").Tilemap.Put(Stack{{Spritesheet: "a", Index: 1}}, x, 0)
+	}
+	walls.Put(Stack{{Spritesheet: "a", Index: 2}}, 1, 0)
+	walls.Put(Stack{{Spritesheet: "b", Index: 2}}, 2, 0)
+	for x, want := range []bool{true, false, false, false} {
+		if got := m.Walkable(x, 0); got != want {
+			t.Fatalf("wrong walkability at %d, 0, got %t, want %t", x, got, want)
+		}
+	}
+	ts.Spritesheets["a"].SetWalkable(2, true)
+	if !m.Walkable(1, 0) || len(ts.Spritesheets["a"].Properties) != 0 {
+		t.Fatal("expected a:2 to be walkable again")
+	}
+}
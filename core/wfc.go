@@ -0,0 +1,550 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+)
+
+const (
+	DefaultBacktracks = 64
+	DefaultRetries    = 8
+)
+
+type WFC struct {
+	*Analysis
+	width, height int
+	banCount      *NDArray[int]
+	banned        *NDArray[bool]
+	support       *NDArray[int]
+	result        *NDArray[*int]
+	stack         [][3]int
+	fixed         Tilemap
+	seed          int64
+	rng           *rand.Rand
+	// Backtracks is how many of the most recent decisions can be undone after a contradiction
+	Backtracks int
+	// Retries is how many times to restart with a new seed once backtracking is exhausted
+	Retries       int
+	trail         []undo
+	decisions     []decision
+	backtracks    int
+	retries       int
+	contradiction bool
+	err           error
+	constraints   []wfcConstraint
+	// reach is how far apart cells can be for the footprints of their entries to overlap
+	reach []image.Point
+}
+
+// wfcConstraint is a Constraint along with which domain entries match it
+type wfcConstraint struct {
+	Constraint
+	matches []bool
+}
+
+// undo restores a single value in one of the solver's arrays
+type undo struct {
+	array int
+	index int
+	value int
+}
+
+const (
+	banCountArray = iota
+	bannedArray
+	supportArray
+	resultArray
+)
+
+// decision records a collapsed cell and the length of the trail before it was collapsed
+type decision struct {
+	x, y, i int
+	mark    int
+}
+
+func init() {
+	RegisterAlgorithm(&Algorithm{
+		Name: "wfc",
+		Params: []Param{
+			{Name: "backtracks", Default: DefaultBacktracks, Min: 0, Max: 4096},
+			{Name: "retries", Default: DefaultRetries, Min: 0, Max: 256},
+			{Name: "sockets", Default: SocketsOff, Min: SocketsOff, Max: SocketsMerged},
+		},
+		New: newWFCGenerator,
+	})
+}
+
+func newWFCGenerator(analysis *Analysis, width, height int, fixed Tilemap, seed int64, opts Options) Generator {
+	g := NewWFC(analysis, width, height, fixed, seed)
+	g.Backtracks = opts["backtracks"]
+	g.Retries = opts["retries"]
+	return g
+}
+
+func NewWFC(analysis *Analysis, width, height int, fixed Tilemap, seed int64) *WFC {
+	g := &WFC{
+		Analysis:   analysis,
+		width:      width,
+		height:     height,
+		fixed:      fixed,
+		seed:       seed,
+		Backtracks: DefaultBacktracks,
+		Retries:    DefaultRetries,
+		reach:      analysis.reach(),
+	}
+	g.reset()
+	return g
+}
+
+func (g *WFC) reset() {
+	g.banCount = NewNDArray[int](g.width, g.height)
+	g.banned = NewNDArray[bool](g.width, g.height, len(g.Domain))
+	g.initializeSupport()
+	g.result = NewNDArray[*int](g.width, g.height)
+	g.trail = nil
+	g.decisions = nil
+	g.backtracks = 0
+	g.contradiction = false
+	g.fixed.Each(func(x, y int, tiles Stack) {
+		// ban everything that doesn't place the fixed stack here, several entries may match in the overlapping model
+		h := tiles.Hash()
+		var matches []int
+		for j, stack := range g.Domain {
+			if stack.Hash() == h {
+				matches = append(matches, j)
+			} else {
+				g.stack = append(g.stack, [3]int{x, y, j})
+			}
+		}
+		if len(matches) == 1 && h != "" {
+			g.result.Set(&matches[0], x, y)
+			g.keepApart(x, y, matches[0])
+		}
+	})
+	for _, c := range g.constraints {
+		r := c.Region.Intersect(image.Rect(0, 0, g.width, g.height))
+		switch c.Kind {
+		case ConstraintBorder:
+			for x := r.Min.X; x < r.Max.X; x++ {
+				for y := r.Min.Y; y < r.Max.Y; y++ {
+					if onBorder(c.Region, x, y) {
+						g.banUnless(x, y, c.matches, true)
+					}
+				}
+			}
+		case ConstraintConnected:
+			for _, p := range c.Points {
+				if p.In(r) {
+					g.banUnless(p.X, p.Y, c.matches, true)
+				}
+			}
+		}
+	}
+	g.rng = rand.New(rand.NewSource(g.seed + int64(g.retries)))
+}
+
+// Constrain makes the generator follow constraints relative to its region as well as the rules of its analysis,
+// starting it again. Borders and the points to connect are limited to the tiles they need before generating, counts
+// are kept within bounds as cells collapse, and a result that still breaks a constraint is tried again.
+func (g *WFC) Constrain(constraints []Constraint) {
+	g.constraints = nil
+	for _, c := range constraints {
+		matches := make([]bool, len(g.Domain))
+		for i, stack := range g.Domain {
+			matches[i] = c.Matches(stack)
+		}
+		g.constraints = append(g.constraints, wfcConstraint{Constraint: c, matches: matches})
+	}
+	g.retries = 0
+	g.err = nil
+	g.reset()
+}
+
+// banUnless queues bans of every entry still allowed at x, y for which matches is not want
+func (g *WFC) banUnless(x, y int, matches []bool, want bool) {
+	for i := range g.Domain {
+		if matches[i] != want && !g.banned.At(x, y, i) {
+			g.stack = append(g.stack, [3]int{x, y, i})
+		}
+	}
+}
+
+// constrainCounts checks each count against the cells that must and may still match it. Once as many must match as
+// allowed the rest are kept from matching, once only as many may match as needed they're made to, and if there are
+// too many or too few it's a contradiction.
+func (g *WFC) constrainCounts() {
+	for _, c := range g.constraints {
+		if c.Kind != ConstraintCount {
+			continue
+		}
+		r := c.Region.Intersect(image.Rect(0, 0, g.width, g.height))
+		must, may := 0, 0
+		for x := r.Min.X; x < r.Max.X; x++ {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				some, all := g.matching(x, y, c.matches)
+				if some {
+					may++
+				}
+				if all {
+					must++
+				}
+			}
+		}
+		if may < c.Min || c.over(must) {
+			g.contradiction = true
+			return
+		}
+		atMax, atMin := c.Max != nil && must == *c.Max, may == c.Min
+		if !atMax && !atMin {
+			continue
+		}
+		for x := r.Min.X; x < r.Max.X; x++ {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				some, all := g.matching(x, y, c.matches)
+				if all || !some {
+					continue
+				}
+				if atMax {
+					g.banUnless(x, y, c.matches, false)
+				} else {
+					g.banUnless(x, y, c.matches, true)
+				}
+			}
+		}
+	}
+}
+
+// constrainPaths is a contradiction once the points of a connected constraint can't be joined through cells that
+// may still match it
+func (g *WFC) constrainPaths() {
+	for _, c := range g.constraints {
+		if c.Kind != ConstraintConnected || len(c.Points) < 2 || g.contradiction {
+			continue
+		}
+		r := c.Region.Intersect(image.Rect(0, 0, g.width, g.height))
+		start := c.Points[0]
+		reached := map[image.Point]bool{start: true}
+		queue := []image.Point{start}
+		for len(queue) > 0 {
+			p := queue[0]
+			queue = queue[1:]
+			for _, d := range g.Grid.Directions() {
+				nx, ny := g.Grid.Neighbor(p.X, p.Y, d)
+				n := image.Pt(nx, ny)
+				if reached[n] || !n.In(r) {
+					continue
+				}
+				if some, _ := g.matching(nx, ny, c.matches); some {
+					reached[n] = true
+					queue = append(queue, n)
+				}
+			}
+		}
+		for _, p := range c.Points[1:] {
+			if !reached[p] {
+				g.contradiction = true
+			}
+		}
+	}
+}
+
+// matching reports whether some and all of the entries still allowed at x, y match
+func (g *WFC) matching(x, y int, matches []bool) (some, all bool) {
+	all = true
+	for i := range g.Domain {
+		if g.banned.At(x, y, i) {
+			continue
+		}
+		if matches[i] {
+			some = true
+		} else {
+			all = false
+		}
+	}
+	return some, all && some
+}
+
+// check returns why the finished result breaks one of the constraints, or nil if it doesn't
+func (g *WFC) check() error {
+	if len(g.constraints) == 0 {
+		return nil
+	}
+	result := g.Result()
+	for _, c := range g.constraints {
+		if err := c.Check(result, g.Grid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *WFC) Done() bool {
+	if g.err != nil {
+		return true
+	}
+	for len(g.stack) > 0 && !g.contradiction {
+		curr := g.stack[len(g.stack)-1]
+		g.stack = g.stack[:len(g.stack)-1]
+		x, y, i := curr[0], curr[1], curr[2]
+		g.ban(x, y, i)
+	}
+	if !g.contradiction {
+		// counts may ban more entries, which are propagated on the next step
+		g.constrainCounts()
+		g.constrainPaths()
+		if len(g.stack) > 0 && !g.contradiction {
+			return false
+		}
+	}
+	if g.contradiction {
+		g.stack = nil
+		if g.backtrack() {
+			return false
+		}
+		return g.retry(errors.New("contradiction"))
+	}
+	if g.collapse() {
+		if err := g.check(); err != nil {
+			return g.retry(err)
+		}
+		return true
+	}
+	return false
+}
+
+// retry starts again from the next seed, returning true if it gives up with err as it's out of retries
+func (g *WFC) retry(err error) bool {
+	if g.retries >= g.Retries {
+		g.err = fmt.Errorf("wfc: %v after %d retries", err, g.retries)
+		return true
+	}
+	g.retries++
+	g.reset()
+	return false
+}
+
+// Err reports why generation failed, or nil if it succeeded or is still running
+func (g *WFC) Err() error {
+	return g.err
+}
+
+// backtrack undoes the most recent decision and bans the choice that led to a contradiction
+func (g *WFC) backtrack() bool {
+	if len(g.decisions) == 0 || g.backtracks >= g.Backtracks {
+		return false
+	}
+	g.backtracks++
+	d := g.decisions[len(g.decisions)-1]
+	g.decisions = g.decisions[:len(g.decisions)-1]
+	for len(g.trail) > d.mark {
+		u := g.trail[len(g.trail)-1]
+		g.trail = g.trail[:len(g.trail)-1]
+		switch u.array {
+		case banCountArray:
+			g.banCount.SetIndex(u.value, u.index)
+		case bannedArray:
+			g.banned.SetIndex(u.value != 0, u.index)
+		case supportArray:
+			g.support.SetIndex(u.value, u.index)
+		case resultArray:
+			if u.value < 0 {
+				g.result.SetIndex(nil, u.index)
+			} else {
+				i := u.value
+				g.result.SetIndex(&i, u.index)
+			}
+		}
+	}
+	g.contradiction = false
+	g.stack = append(g.stack, [3]int{d.x, d.y, d.i})
+	return true
+}
+
+// record saves the current value at index so it can be restored by backtracking
+func (g *WFC) record(array, index int) {
+	if len(g.decisions) == 0 {
+		// nothing to backtrack to
+		return
+	}
+	var value int
+	switch array {
+	case banCountArray:
+		value = g.banCount.AtIndex(index)
+	case bannedArray:
+		if g.banned.AtIndex(index) {
+			value = 1
+		}
+	case supportArray:
+		value = g.support.AtIndex(index)
+	case resultArray:
+		if r := g.result.AtIndex(index); r != nil {
+			value = *r
+		} else {
+			value = -1
+		}
+	}
+	g.trail = append(g.trail, undo{array: array, index: index, value: value})
+}
+
+func (g *WFC) Result() [][]Stack {
+	shape := g.result.Shape()
+	r := make([][]Stack, shape[0])
+	for x := 0; x < shape[0]; x++ {
+		r[x] = make([]Stack, shape[1])
+		for y := 0; y < shape[1]; y++ {
+			if i := g.result.At(x, y); i != nil {
+				r[x][y] = g.Domain[*i]
+			}
+		}
+	}
+	return r
+}
+
+func (g *WFC) leastEntropy() (int, int) {
+	minX, minY := -1, -1
+	minEntropy := math.MaxFloat64
+	for x := 0; x < g.width; x++ {
+		for y := 0; y < g.height; y++ {
+			if entropy := g.entropy(x, y); entropy < minEntropy {
+				minEntropy = entropy
+				minX, minY = x, y
+			}
+		}
+	}
+	return minX, minY
+}
+
+func (g *WFC) entropy(x, y int) float64 {
+	if g.result.At(x, y) != nil {
+		return math.MaxFloat64
+	}
+	var e float64
+	for i, p := range g.Probabilities {
+		if p > 0 && !g.banned.At(x, y, i) {
+			e -= p * math.Log(p)
+		}
+	}
+	return e
+}
+
+// Entropy is the entropy of the cell at x, y relative to an uncollapsed cell, or 0 once it has collapsed
+func (g *WFC) Entropy(x, y int) float64 {
+	e := g.entropy(x, y)
+	if e == math.MaxFloat64 {
+		return 0
+	}
+	var total float64
+	for _, p := range g.Probabilities {
+		if p > 0 {
+			total -= p * math.Log(p)
+		}
+	}
+	if total <= 0 {
+		return 0
+	}
+	return e / total
+}
+
+func (g *WFC) collapse() bool {
+	x, y := g.leastEntropy()
+	if x < 0 || y < 0 {
+		return true
+	}
+	winner := g.Lottery(g.rng, func(i int) bool {
+		return !g.banned.At(x, y, i)
+	})
+	if winner == -1 {
+		g.contradiction = true
+		return false
+	}
+	g.decisions = append(g.decisions, decision{x: x, y: y, i: winner, mark: len(g.trail)})
+	if g.Backtracks <= 0 {
+		g.decisions, g.trail = nil, nil
+	} else if len(g.decisions) > g.Backtracks {
+		// forget the oldest decision and everything needed to undo it
+		mark := g.decisions[1].mark
+		g.trail = append(g.trail[:0], g.trail[mark:]...)
+		g.decisions = append(g.decisions[:0], g.decisions[1:]...)
+		for i := range g.decisions {
+			g.decisions[i].mark -= mark
+		}
+	}
+	for i := 0; i < len(g.Domain); i++ {
+		if i != winner {
+			g.stack = append(g.stack, [3]int{x, y, i})
+		}
+	}
+	g.record(resultArray, g.result.Index(x, y))
+	g.result.Set(&winner, x, y)
+	g.keepApart(x, y, winner)
+	return false
+}
+
+// keepApart queues bans of the entries of the cells around x, y whose footprints would overlap that of entry i
+func (g *WFC) keepApart(x, y, i int) {
+	for _, d := range g.reach {
+		nx, ny := x+d.X, y+d.Y
+		if nx < 0 || nx >= g.width || ny < 0 || ny >= g.height || g.result.At(nx, ny) != nil {
+			continue
+		}
+		for j := range g.Domain {
+			if !g.banned.At(nx, ny, j) && g.Overlaps(i, j, d) {
+				g.stack = append(g.stack, [3]int{nx, ny, j})
+			}
+		}
+	}
+}
+
+func (g *WFC) ban(x, y, i int) {
+	if g.banned.At(x, y, i) {
+		return
+	}
+	g.record(bannedArray, g.banned.Index(x, y, i))
+	g.banned.Set(true, x, y, i)
+	banCount := g.banCount.At(x, y) + 1
+	g.record(banCountArray, g.banCount.Index(x, y))
+	g.banCount.Set(banCount, x, y)
+	if banCount == len(g.Domain) {
+		g.contradiction = true
+		return
+	}
+	// for each possible neighbor, remove this tile from support in the given direction
+	for _, d := range g.Grid.Directions() {
+		nx, ny := g.Grid.Neighbor(x, y, d)
+		if nx < 0 || nx >= g.width || ny < 0 || ny >= g.height {
+			continue
+		}
+		if g.result.At(nx, ny) != nil {
+			continue
+		}
+		for n := range g.Adj.At(i, int(d)) {
+			g.record(supportArray, g.support.Index(nx, ny, n, int(d)))
+			g.support.Set(g.support.At(nx, ny, n, int(d))-1, nx, ny, n, int(d))
+			if g.support.At(nx, ny, n, int(d)) == 0 {
+				g.stack = append(g.stack, [3]int{nx, ny, n})
+			}
+		}
+	}
+}
+
+func (g *WFC) initializeSupport() {
+	g.stack = nil
+	g.support = NewNDArray[int](g.width, g.height, len(g.Domain), NumDirections)
+	for x := 0; x < g.width; x++ {
+		for y := 0; y < g.height; y++ {
+			for i := range g.Domain {
+				for _, d := range g.Grid.Directions() {
+					support := len(g.Adj.At(i, int(d.Inverse())))
+					if support == 0 {
+						g.stack = append(g.stack, [3]int{x, y, i})
+					} else {
+						g.support.Set(support, x, y, i, int(d))
+					}
+				}
+			}
+		}
+	}
+}
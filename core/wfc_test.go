@@ -0,0 +1,141 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWFC(t *testing.T) {
+	m := make(Tilemap)
+	tiles := []*Tile{
+		{Spritesheet: ".", Index: 0}, // [.]
+		{Spritesheet: "|", Index: 1}, // [|]
+		{Spritesheet: "-", Index: 2}, // [-]
+		{Spritesheet: "+", Index: 3}, // [+]
+	}
+	/*
+		+-+ -+-
+		|.| .|.
+		+-+ -+-
+	*/
+	m.Set(tiles[3], 0, 0, false, 0)
+	m.Set(tiles[2], 1, 0, false, 0)
+	m.Set(tiles[3], 2, 0, false, 0)
+	m.Set(tiles[1], 0, 1, false, 0)
+	m.Set(tiles[0], 1, 1, false, 0)
+	m.Set(tiles[1], 2, 1, false, 0)
+	m.Set(tiles[3], 0, 2, false, 0)
+	m.Set(tiles[2], 1, 2, false, 0)
+	m.Set(tiles[3], 2, 2, false, 0)
+	m.Set(tiles[2], 0, 0, false, 1)
+	m.Set(tiles[3], 1, 0, false, 1)
+	m.Set(tiles[2], 2, 0, false, 1)
+	m.Set(tiles[0], 0, 1, false, 1)
+	m.Set(tiles[1], 1, 1, false, 1)
+	m.Set(tiles[0], 2, 1, false, 1)
+	m.Set(tiles[2], 0, 2, false, 1)
+	m.Set(tiles[3], 1, 2, false, 1)
+	m.Set(tiles[2], 2, 2, false, 1)
+	g := NewWFC(Analyze(m, GridSquare), 6, 6, nil, time.Now().UnixMilli())
+	if got, want := g.width, 6; got != want {
+	}
+	if got, want := g.height, 6; got != want {
+		t.Fatalf("wrong height, got %d, want %d", got, want)
+	}
+	for !g.Done() {
+	}
+	if err := g.Err(); err != nil {
+		t.Fatal(err)
+	}
+	result := g.Result()
+	if got, want := len(result), 6; got != want {
+		t.Fatalf("wrong width, got %d, want %d", got, want)
+	}
+	if got, want := len(result[0]), 6; got != want {
+		t.Fatalf("wrong height, got %d, want %d", got, want)
+	}
+	for x := 0; x < len(result); x++ {
+		for y := 0; y < len(result[x]); y++ {
+			fmt.Printf("%s", result[x][y].Hash())
+		}
+		fmt.Println()
+	}
+}
+
+func TestWFCContradiction(t *testing.T) {
+	m := make(Tilemap)
+	a, b := &Tile{Spritesheet: "a", Index: 1}, &Tile{Spritesheet: "b", Index: 2}
+	// b can only be east of a, so there is no tile that fits between two a's
+	m.Set(a, 0, 0, false, 0)
+	m.Set(b, 1, 0, false, 0)
+	fixed := make(Tilemap)
+	fixed.Set(a, 0, 0, false, 0)
+	fixed.Set(a, 2, 0, false, 0)
+	g := NewWFC(Analyze(m, GridSquare), 3, 1, fixed, 1)
+	g.Retries = 2
+	for i := 0; !g.Done(); i++ {
+		if i > 1000 {
+			t.Fatal("expected generation to give up")
+		}
+	}
+	if g.Err() == nil {
+		t.Fatal("expected contradiction error")
+	}
+	if got, want := g.retries, 2; got != want {
+		t.Fatalf("wrong number of retries, got %d, want %d", got, want)
+	}
+}
+
+func TestWFCBacktrack(t *testing.T) {
+	m := make(Tilemap)
+	for i := 1; i <= 3; i++ {
+		m.Set(&Tile{Spritesheet: "c", Index: i}, i, 0, false, 0)
+	}
+	a := Analyze(m, GridSquare)
+	c := func(i int) int {
+		return a.DomainIndex[Stack{{Spritesheet: "c", Index: i}}.Hash()]
+	}
+	for i := 1; i <= 3; i++ {
+		for j := 1; j <= 3; j++ {
+			a.Allow(c(i), East, c(j), false)
+			a.Allow(c(i), South, c(j), false)
+		}
+	}
+	for _, r := range [][2]int{{1, 1}, {2, 3}, {3, 2}} {
+		a.Allow(c(r[0]), East, c(r[1]), true)
+	}
+	for _, r := range [][2]int{{1, 2}, {2, 2}, {3, 1}, {3, 3}} {
+		a.Allow(c(r[0]), South, c(r[1]), true)
+	}
+	// every tile has neighbors on all sides, but 1 leads nowhere in a 2x2 region, so picking it first has to be undone
+	a.Probabilities[c(1)], a.Probabilities[c(2)], a.Probabilities[c(3)] = 0.98, 0.01, 0.01
+	g := NewWFC(a, 2, 2, nil, 1)
+	g.Retries = 0
+	for i := 0; !g.Done(); i++ {
+		if i > 1000 {
+			t.Fatal("expected generation to finish")
+		}
+	}
+	if err := g.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if g.backtracks == 0 {
+		t.Fatal("expected the first choice to be undone")
+	}
+	result := g.Result()
+	for x := 0; x < 2; x++ {
+		for y := 0; y < 2; y++ {
+			i, ok := a.DomainIndex[result[x][y].Hash()]
+			if !ok || i == 0 {
+				t.Fatalf("empty cell %d, %d", x, y)
+			}
+			if x > 0 && !a.Allowed(a.DomainIndex[result[x-1][y].Hash()], East, i) {
+				t.Fatalf("%s can't be east of %s", result[x][y].Hash(), result[x-1][y].Hash())
+			}
+			if y > 0 && !a.Allowed(a.DomainIndex[result[x][y-1].Hash()], South, i) {
+				t.Fatalf("%s can't be south of %s", result[x][y].Hash(), result[x][y-1].Hash())
+			}
+		}
+	}
+}
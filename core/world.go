@@ -0,0 +1,160 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"image"
+)
+
+// worldAttempts is how many seeds a chunk of a World is generated with before giving up on a contradiction, or on
+// a generator getting stuck with cells left empty
+const worldAttempts = 4
+
+// World generates an endless map a chunk at a time from rules learned when it's created, each chunk the same
+// whichever order they're generated in
+type World struct {
+	Map       *Map
+	Layers    []string
+	Algorithm string
+	Options   Options
+	Seed      int64
+	analysis  *Analysis
+	authored  map[image.Point]bool
+	generated map[image.Point]bool
+}
+
+// NewWorld starts a world around the named layers of m, or all of its layers if layers is nil, learning from their
+// current tiles or following m's Ruleset if it has one
+func NewWorld(m *Map, layers []string, algorithm string, opts Options, seed int64) (*World, error) {
+	if layers == nil {
+		layers = m.LayerNames()
+	}
+	sample := m.Combine(layers)
+	analysis, err := m.rules(sample, algorithm, opts)
+	if err != nil {
+		return nil, err
+	}
+	w := &World{
+		Map:       m,
+		Layers:    layers,
+		Algorithm: algorithm,
+		Options:   opts,
+		Seed:      seed,
+		analysis:  analysis,
+		authored:  make(map[image.Point]bool),
+		generated: make(map[image.Point]bool),
+	}
+	for _, c := range sample.Chunks() {
+		w.authored[c] = true
+	}
+	return w, nil
+}
+
+// ChunkSeed is the seed the chunk at c is generated from
+func (w *World) ChunkSeed(c image.Point) int64 {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, [3]int64{w.Seed, int64(c.X), int64(c.Y)})
+	return int64(h.Sum64())
+}
+
+// Generated is true once the chunk at c holds the world's tiles, either drawn before the world was created or
+// generated since
+func (w *World) Generated(c image.Point) bool {
+	return w.authored[c] || w.generated[c]
+}
+
+// Generate fills the chunk at c, along with any neighbors it must fit to, returning the chunks it generated. If
+// every attempt at a chunk contradicts itself the last attempt is kept as far as it got.
+func (w *World) Generate(c image.Point) ([]image.Point, error) {
+	if w.Generated(c) {
+		return nil, nil
+	}
+	// even chunks only fit to authored ones, and odd chunks fit between the even chunks around them
+	odd := (c.X+c.Y)&1 != 0
+	var chunks []image.Point
+	rect := ChunkRect(c)
+	region := rect
+	fixed := make(Tilemap)
+	for _, d := range []Direction{North, South, West, East} {
+		n := c.Add(image.Pt(Neighbors[d][0], Neighbors[d][1]))
+		if !w.authored[n] && !odd {
+			continue
+		}
+		if odd {
+			generated, err := w.Generate(n)
+			chunks = append(chunks, generated...)
+			if err != nil {
+				return chunks, err
+			}
+		}
+		// the row or column of the neighbor along the shared edge
+		border := rect.Add(image.Pt(Neighbors[d][0]*ChunkSize, Neighbors[d][1]*ChunkSize)).Intersect(rect.Inset(-1))
+		for x := border.Min.X; x < border.Max.X; x++ {
+			for y := border.Min.Y; y < border.Max.Y; y++ {
+				fixed.Put(w.Map.combined(w.Layers, x, y), x, y)
+			}
+		}
+		region = region.Union(border)
+	}
+	var gen *Generation
+	var err error
+	for attempt := 0; attempt < worldAttempts; attempt++ {
+		gen, err = NewRulesetGeneration(w.analysis, fixed, w.Map.Tileset, region, w.Algorithm, w.Options, w.ChunkSeed(c)+int64(attempt))
+		if err != nil {
+			return chunks, err
+		}
+		for !gen.Step(region.Dx() * region.Dy()) {
+		}
+		if gen.Err == nil && !incomplete(gen, rect) {
+			break
+		}
+	}
+	w.generated[c] = true
+	chunks = append(chunks, c)
+	result := gen.Result()
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			if stack := result[x-region.Min.X][y-region.Min.Y]; stack != nil {
+				w.Map.Split(w.Layers, stack, x, y, nil)
+			}
+		}
+	}
+	if gen.Err != nil {
+		return chunks, fmt.Errorf("chunk %d, %d: %w", c.X, c.Y, gen.Err)
+	}
+	if incomplete(gen, rect) {
+		return chunks, fmt.Errorf("chunk %d, %d: %s got stuck", c.X, c.Y, w.Algorithm)
+	}
+	return chunks, nil
+}
+
+// incomplete is true if gen left any cell of rect empty
+func incomplete(gen *Generation, rect image.Rectangle) bool {
+	result := gen.Result()
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			if result[x-gen.Rect.Min.X][y-gen.Rect.Min.Y] == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Around generates every chunk within radius chunks of the one holding the cell at x, y, returning the chunks it
+// generated
+func (w *World) Around(x, y, radius int) ([]image.Point, error) {
+	center := image.Pt(x>>chunkShift, y>>chunkShift)
+	var chunks []image.Point
+	for cy := center.Y - radius; cy <= center.Y+radius; cy++ {
+		for cx := center.X - radius; cx <= center.X+radius; cx++ {
+			generated, err := w.Generate(image.Pt(cx, cy))
+			chunks = append(chunks, generated...)
+			if err != nil {
+				return chunks, err
+			}
+		}
+	}
+	return chunks, nil
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"image"
+	"testing"
+)
+
+// worldSample tiles endlessly, but a:0 and a:2 never touch
+func worldSample() *Map {
+	m := NewMap(16, 16, nil)
+	l := m.Layer("Layer 1")
+	for y, row := range []string{"001122", "011221", "112210", "122100", "221001", "210011"} {
+		for x, c := range row {
+			l.Tilemap.Put(Stack{{Spritesheet: "a", Index: int(c - '0')}}, x, y)
+		}
+	}
+	return m
+}
+
+func TestWorldDeterministic(t *testing.T) {
+	chunks := []image.Point{{1, 0}, {-1, 0}, {0, 1}, {1, 1}, {2, 3}}
+	for _, alg := range []string{"greedy", "wfc"} {
+		forward, err := NewWorld(worldSample(), nil, alg, nil, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backward, err := NewWorld(worldSample(), nil, alg, nil, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range chunks {
+			if _, err := forward.Generate(chunks[i]); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := backward.Generate(chunks[len(chunks)-1-i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if generated, _ := forward.Generate(image.Pt(0, 0)); len(generated) != 0 {
+			t.Fatalf("%s: regenerated the sample", alg)
+		}
+		if got, want := forward.Map.Layer("Layer 1").Tilemap.Get(2, 1).Hash(), "a:1"; got != want {
+			t.Fatalf("%s: sample changed, got %q, want %q", alg, got, want)
+		}
+		a, b := forward.Map.Layer("Layer 1").Tilemap, backward.Map.Layer("Layer 1").Tilemap
+		for _, c := range chunks {
+			rect := ChunkRect(c)
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				for y := rect.Min.Y; y < rect.Max.Y; y++ {
+					if len(a.Get(x, y)) == 0 {
+						t.Fatalf("%s: empty cell %d, %d", alg, x, y)
+					}
+					if a.Get(x, y).Hash() != b.Get(x, y).Hash() {
+						t.Fatalf("%s: cell %d, %d depends on the order chunks were generated in", alg, x, y)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestWorldBorders(t *testing.T) {
+	// chunks have to fit the chunks beside them
+	m := worldSample()
+	l := m.Layer("Layer 1")
+	w, err := NewWorld(m, nil, "wfc", nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Around(ChunkSize+1, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 3*ChunkSize; x++ {
+		for y := -ChunkSize; y < 2*ChunkSize; y++ {
+			i := w.analysis.DomainIndex[l.Tilemap.Get(x, y).Hash()]
+			for _, d := range []Direction{South, East} {
+				nx, ny := x+Neighbors[d][0], y+Neighbors[d][1]
+				if nx >= 3*ChunkSize || ny >= 2*ChunkSize {
+					continue
+				}
+				n := w.analysis.DomainIndex[l.Tilemap.Get(nx, ny).Hash()]
+				// the sample's chunk is left as it was drawn
+				if i == 0 || n == 0 {
+					continue
+				}
+				if !w.analysis.Allowed(i, d, n) {
+					t.Fatalf("%q at %d, %d can't be %s of %q", l.Tilemap.Get(nx, ny).Hash(), nx, ny, d, l.Tilemap.Get(x, y).Hash())
+				}
+			}
+		}
+	}
+}
@@ -2,17 +2,23 @@ package main
 
 import (
 	"image"
+	"image/color"
 	"log"
 	"math"
+	"math/rand"
+	"strconv"
 	"time"
 
 	"github.com/etherealmachine/bento"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"weave/core"
 )
 
 type Editor struct {
+	*Keyboard
 	Selection              *image.Rectangle
 	Map                    *Map
 	MapScale, TilesetScale float64
@@ -21,16 +27,53 @@ type Editor struct {
 	HoverX, HoverY         int
 	Frame                  *bento.NineSlice
 	TileSelector           *TileSelector
+	RuleEditor             *RuleEditor
+	TilesetEditor          *TilesetEditor
+	Algorithm              string
+	Options                map[string]core.Options
+	Generation             *core.Generation
+	StepsPerFrame          int
+	Heatmap                bool
+	Layer                  string
+	Clipboard              *core.Stamp
+	Pasting                bool
+	skipLayers             map[string]bool
+	stroke                 bool
+	strokeStart            image.Point
+	painted                map[image.Point]bool
+	rng                    *rand.Rand
+	pixel                  *ebiten.Image
 }
 
 func NewEditor() *Editor {
-	tileset := NewTileset("tilesets")
+	m := NewMap(16, 16, core.NewTileset())
+	if err := m.UseManifest(manifestFilename); err != nil {
+		log.Fatal(err)
+	}
+	keyboard := new(Keyboard)
 	ui := &Editor{
-		Map:          NewMap(16, 16, tileset),
-		MapScale:     1,
-		TilesetScale: 1,
-		TileSelector: NewTileSelector(tileset),
+		Keyboard:      keyboard,
+		Map:           m,
+		MapScale:      1,
+		TilesetScale:  1,
+		TileSelector:  NewTileSelector(m.Textures, keyboard),
+		Algorithm:     "greedy",
+		Options:       make(map[string]core.Options),
+		StepsPerFrame: 4,
+		Layer:         m.Layers[0].Name,
+		skipLayers:    make(map[string]bool),
+		rng:           rand.New(rand.NewSource(time.Now().UnixNano())),
+		pixel:         ebiten.NewImage(1, 1),
 	}
+	ui.TilesetEditor = NewTilesetEditor(m, ui.TileSelector)
+	ui.RuleEditor = NewRuleEditor(m, func() (*core.Analysis, error) {
+		a, err := core.LookupAlgorithm(ui.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		return a.Analysis(m.Combine(ui.generateLayers()), m.Grid, m.Tileset, ui.Options[ui.Algorithm])
+	})
+	ui.pixel.Fill(color.White)
 	img, _, err := ebitenutil.NewImageFromFile("ui/frame.png")
 	if err != nil {
 		log.Fatal(err)
@@ -40,61 +83,85 @@ func NewEditor() *Editor {
 }
 
 func (ui *Editor) Draw(event *bento.Event) {
-	if ebiten.IsKeyPressed(ebiten.KeyControl) {
-		ui.drawHoverTile(event)
-	}
 	ui.drawMap(event)
-	if !ebiten.IsKeyPressed(ebiten.KeyControl) {
-		ui.drawHoverTile(event)
+	if ui.Generation != nil {
+		ui.drawGeneration(event)
 	}
+	ui.drawHoverTile(event)
 	if ui.Selection != nil {
 		ui.drawSelection(event)
 	}
 }
 
 func (ui *Editor) drawMap(event *bento.Event) {
+	ui.Map.DrawLayers(event.Image, ui.view(event), nil)
+}
+
+// drawGeneration draws the in-progress generation as a translucent overlay, optionally over an entropy heatmap
+func (ui *Editor) drawGeneration(event *bento.Event) {
 	w, h := float64(ui.Map.TileWidth), float64(ui.Map.TileHeight)
-	ox, oy := math.Floor(ui.OffsetX/w)*w, math.Floor(ui.OffsetY/h)*h
-	for x, ys := range ui.Map.Tilemap {
-		for y, tiles := range ys {
-			for _, tile := range tiles {
-				img := ui.Map.Image(tile)
-				if img == nil {
-					log.Fatal(tile)
-				}
+	view := ui.view(event)
+	rect := ui.Generation.Rect
+	result := ui.Generation.Result()
+	for x := 0; x < rect.Dx(); x++ {
+		for y := 0; y < rect.Dy(); y++ {
+			if e, ok := ui.Generation.Entropy(x, y); ok && ui.Heatmap {
 				op := new(ebiten.DrawImageOptions)
-				op.GeoM.Translate(float64(event.Box.X), float64(event.Box.Y))
-				op.GeoM.Translate(float64(x)*w, float64(y)*h)
-				op.GeoM.Translate(ox, oy)
-				op.GeoM.Scale(ui.MapScale, ui.MapScale)
-				//op.GeoM.Skew(-0.7, 0)
-				event.Image.DrawImage(img, op)
+				op.GeoM.Scale(w, h)
+				op.GeoM.Concat(ui.Map.cellGeoM(x+rect.Min.X, y+rect.Min.Y))
+				op.GeoM.Concat(view)
+				op.ColorM.Scale(e, 0, 1-e, 0.5)
+				event.Image.DrawImage(ui.pixel, op)
+			}
+			if x >= len(result) || y >= len(result[x]) {
+				continue
+			}
+			for _, tile := range result[x][y] {
+				ui.Map.DrawTile(event.Image, tile, x+rect.Min.X, y+rect.Min.Y, view, 0.6)
 			}
 		}
 	}
 }
 
+// drawPreview draws a tile about to be placed in layer l, standing up if the layer is upright in a projected view
+func (ui *Editor) drawPreview(event *bento.Event, l *core.Layer, tile *core.Tile, x, y int, opacity float64) {
+	if l != nil && l.Upright && ui.Map.Projection != core.ProjectionTopDown {
+		ui.Map.DrawSprite(event.Image, tile, x, y, ui.view(event), opacity)
+	} else {
+		ui.Map.DrawTile(event.Image, tile, x, y, ui.view(event), opacity)
+	}
+}
+
+// drawStamp draws a translucent preview of s with its top left corner at x, y
+func (ui *Editor) drawStamp(event *bento.Event, s *core.Stamp, x, y int) {
+	for _, l := range ui.Map.Layers {
+		tilemaps := []core.Tilemap{s.Layers[l.Name]}
+		if l.Name == ui.Layer {
+			tilemaps = append(tilemaps, s.Layers[""])
+		}
+		for _, tilemap := range tilemaps {
+			tilemap.Each(func(sx, sy int, tiles core.Stack) {
+				for _, tile := range tiles {
+					ui.drawPreview(event, l, tile, x+sx, y+sy, 0.5)
+				}
+			})
+		}
+	}
+}
+
 func (ui *Editor) drawHoverTile(event *bento.Event) {
-	if tile := ui.Map.Image(ui.TileSelector.Selected); tile != nil {
-		bounds := tile.Bounds()
-		w, h := ui.MapScale*float64(bounds.Dx()), ui.MapScale*float64(bounds.Dy())
-		op := new(ebiten.DrawImageOptions)
-		op.GeoM.Translate(float64(event.Box.X), float64(event.Box.Y))
-		op.GeoM.Scale(ui.MapScale, ui.MapScale)
-		op.GeoM.Translate(math.Floor(float64(event.X)/w)*w, math.Floor(float64(event.Y)/h)*h)
-		event.Image.DrawImage(tile, op)
+	if ui.Pasting {
+		ui.drawStamp(event, ui.Clipboard, ui.HoverX, ui.HoverY)
+	} else if ui.TileSelector.Stamp != nil {
+		ui.drawStamp(event, ui.TileSelector.Stamp, ui.HoverX, ui.HoverY)
+	} else if tile := ui.TileSelector.Selected; ui.Map.Image(tile) != nil {
+		ui.drawPreview(event, ui.Map.Layer(ui.Layer), tile, ui.HoverX, ui.HoverY, 1)
+		// outline the cells a tile larger than a cell covers
+		if footprint := ui.Map.Footprint(tile, ui.Map.TileWidth, ui.Map.TileHeight); footprint.Dx() > 1 || footprint.Dy() > 1 {
+			ui.drawFrame(event, footprint.Add(image.Pt(ui.HoverX, ui.HoverY)))
+		}
 	} else {
-		op := new(ebiten.DrawImageOptions)
-		op.GeoM.Translate(float64(event.Box.X), float64(event.Box.Y))
-		w := float64(ui.Map.TileWidth) * ui.MapScale
-		h := float64(ui.Map.TileHeight) * ui.MapScale
-		ui.Frame.Draw(
-			event.Image,
-			int(math.Floor(float64(event.X)/w)*w),
-			int(math.Floor(float64(event.Y)/h)*h),
-			int(w),
-			int(h),
-			op)
+		ui.drawFrame(event, image.Rect(ui.HoverX, ui.HoverY, ui.HoverX+1, ui.HoverY+1))
 	}
 }
 
@@ -102,16 +169,31 @@ func (ui *Editor) drawSelection(event *bento.Event) {
 	if ui.Selection == nil || ui.Selection.Dx() == 0 || ui.Selection.Dy() == 0 {
 		return
 	}
-	w, h := float64(ui.Map.TileWidth), float64(ui.Map.TileHeight)
-	ox, oy := math.Floor(ui.OffsetX/w)*w, math.Floor(ui.OffsetY/h)*h
-	op := new(ebiten.DrawImageOptions)
-	op.GeoM.Translate(float64(event.Box.X), float64(event.Box.Y))
-	ui.Frame.Draw(event.Image,
-		int((float64(ui.Selection.Min.X)*w+ox)*ui.MapScale),
-		int((float64(ui.Selection.Min.Y)*h+oy)*ui.MapScale),
-		int(float64(ui.Selection.Dx())*w*ui.MapScale),
-		int(float64(ui.Selection.Dy())*h*ui.MapScale),
-		op)
+	ui.drawFrame(event, *ui.Selection)
+}
+
+// drawFrame outlines the cells of rect, with a frame when viewed top down and along its projected edges otherwise
+func (ui *Editor) drawFrame(event *bento.Event, rect image.Rectangle) {
+	bounds := ui.Map.Grid.Bounds(rect, ui.Map.TileWidth, ui.Map.TileHeight)
+	g := ui.Map.cellGeoM(rect.Min.X, rect.Min.Y)
+	g.Concat(ui.view(event))
+	if ui.Map.Projection == core.ProjectionTopDown {
+		x, y := g.Apply(float64(bounds.Min.X), float64(bounds.Min.Y))
+		ui.Frame.Draw(event.Image,
+			int(x),
+			int(y),
+			int(float64(bounds.Dx())*ui.MapScale),
+			int(float64(bounds.Dy())*ui.MapScale),
+			new(ebiten.DrawImageOptions))
+		return
+	}
+	corners := []image.Point{bounds.Min, image.Pt(bounds.Max.X, bounds.Min.Y), bounds.Max, image.Pt(bounds.Min.X, bounds.Max.Y)}
+	for i, c := range corners {
+		n := corners[(i+1)%len(corners)]
+		x1, y1 := g.Apply(float64(c.X), float64(c.Y))
+		x2, y2 := g.Apply(float64(n.X), float64(n.Y))
+		ebitenutil.DrawLine(event.Image, x1, y1, x2, y2, color.White)
+	}
 }
 
 func (ui *Editor) OnMapScroll(event *bento.Event) bool {
@@ -140,45 +222,116 @@ func (ui *Editor) OnTilesetScroll(event *bento.Event) bool {
 
 func (ui *Editor) Click(event *bento.Event) {
 	ui.HoverX, ui.HoverY = ui.mapTilePos(event.X, event.Y)
-	if ui.TileSelector.Selected == nil {
+	if ui.TileSelector.Selected == nil && ui.TileSelector.Stamp == nil && !ui.Pasting {
 		ui.Drag = &[2]int{ui.HoverX, ui.HoverY}
 		selection := image.Rect(ui.HoverX, ui.HoverY, ui.HoverX, ui.HoverY)
 		ui.Selection = &selection
 	}
 }
 
-func (ui *Editor) Hover(event *bento.Event) {
-	ui.HoverX, ui.HoverY = ui.mapTilePos(event.X, event.Y)
-	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
-		ui.TileSelector.Selected = nil
-		ui.Selection = nil
-	} else if ui.Selection != nil {
-		if inpututil.IsKeyJustPressed(ebiten.KeyG) {
-			ui.Map.Generate(*ui.Selection, time.Now().UnixMilli())
-		} else if inpututil.IsKeyJustPressed(ebiten.KeyDelete) || inpututil.IsKeyJustPressed(ebiten.KeyBackspace) {
-			ui.Map.Erase(*ui.Selection)
-		}
+// Update advances any in-progress generation by a bounded number of steps each frame
+func (ui *Editor) Update() bool {
+	ui.Keyboard.update()
+	if ui.Generation == nil || ui.Generation.Paused || ui.Generation.Finished {
+		return false
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyUp) {
-		ui.OffsetY++
+	if ui.Generation.Step(ui.StepsPerFrame) && ui.Generation.Err != nil {
+		log.Println(ui.Generation.Err)
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyDown) {
-		ui.OffsetY--
+	return true
+}
+
+// Reroll generates the region being previewed again from a new seed
+func (ui *Editor) Reroll(event *bento.Event) {
+	ui.reseed(ui.rng.Int63())
+}
+
+// SetSeed generates the region being previewed again from the seed typed in
+func (ui *Editor) SetSeed(event *bento.Event) {
+	seed, err := strconv.ParseInt(event.Value, 10, 64)
+	if err != nil || ui.Generation == nil || seed == ui.Generation.Seed {
+		return
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
-		ui.OffsetX++
+	ui.reseed(seed)
+}
+
+func (ui *Editor) reseed(seed int64) {
+	if ui.Generation == nil {
+		return
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyRight) {
-		ui.OffsetX--
+	gen, err := ui.Generation.Reseed(seed)
+	if err != nil {
+		log.Println(err)
+		return
 	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
-		game.SetScene(NewExplore(ui.Map))
+	ui.Generation = gen
+}
+
+// maxRecordRows is how many of the map's generations within the selection are listed to be run again
+const maxRecordRows = 4
+
+type recordRow struct {
+	Index int
+	*core.Record
+}
+
+// Records lists the most recent generations of the map overlapping the selection, newest first
+func (ui *Editor) Records() []recordRow {
+	if ui.Selection == nil || ui.Generation != nil {
+		return nil
+	}
+	var rows []recordRow
+	for i := len(ui.Map.Generations) - 1; i >= 0 && len(rows) < maxRecordRows; i-- {
+		if r := ui.Map.Generations[i]; r.Rect.Overlaps(*ui.Selection) {
+			rows = append(rows, recordRow{Index: i, Record: r})
+		}
+	}
+	return rows
+}
+
+// Rerun previews one of the map's generations run again from its seed, selecting its region
+func (ui *Editor) Rerun(event *bento.Event) {
+	i, err := strconv.Atoi(event.Box.Attrs["record"])
+	if err != nil || i < 0 || i >= len(ui.Map.Generations) {
+		return
+	}
+	r := ui.Map.Generations[i]
+	gen, err := ui.Map.Regenerate(r, r.Seed)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	rect := r.Rect
+	ui.Selection = &rect
+	ui.Generation = gen
+}
+
+func (ui *Editor) Hover(event *bento.Event) {
+	ui.HoverX, ui.HoverY = ui.mapTilePos(event.X, event.Y)
+	if !ui.Typing() {
+		ui.hotkeys()
 	}
 
+	// group everything painted or erased while a button is held into a single undo step
 	tileX, tileY := ui.mapTilePos(event.X, event.Y)
+	pressed := ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) || ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight)
+	if pressed && !ui.stroke {
+		ui.Map.History.Begin("paint")
+		ui.stroke = true
+		ui.strokeStart = image.Pt(tileX, tileY)
+		ui.painted = make(map[image.Point]bool)
+	} else if !pressed && ui.stroke {
+		ui.Map.History.Commit()
+		ui.stroke = false
+	}
+
 	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) {
-		ui.Map.EraseTile(tileX, tileY)
-	} else if ui.TileSelector.Selected == nil && ui.Drag != nil && ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		ui.Map.EraseTile(ui.Layer, tileX, tileY)
+	} else if ui.Pasting {
+		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+			ui.Map.Paste(ui.Clipboard, tileX, tileY, ui.Layer)
+		}
+	} else if ui.TileSelector.Selected == nil && ui.TileSelector.Stamp == nil && ui.Drag != nil && ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
 		selection := image.Rect(ui.Drag[0], ui.Drag[1], tileX+1, tileY+1)
 		ui.Selection = &selection
 	} else if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
@@ -187,12 +340,7 @@ func (ui *Editor) Hover(event *bento.Event) {
 			ui.Selection = nil
 		}
 	} else if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
-		z := math.MaxInt
-		if ebiten.IsKeyPressed(ebiten.KeyControl) {
-			z = 0
-		}
-		ui.Map.Tilemap.Set(ui.TileSelector.Selected, tileX, tileY, ebiten.IsKeyPressed(ebiten.KeyShift), z)
-		ui.Map.Save("map.json")
+		ui.paint(tileX, tileY)
 	}
 
 	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonMiddle) {
@@ -206,6 +354,122 @@ func (ui *Editor) Hover(event *bento.Event) {
 	}
 }
 
+// hotkeys handles the keyboard, other than while typing into an input
+func (ui *Editor) hotkeys() {
+	if ebiten.IsKeyPressed(ebiten.KeyControl) && inpututil.IsKeyJustPressed(ebiten.KeyZ) {
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			ui.Map.Redo()
+		} else {
+			ui.Map.Undo()
+		}
+	} else if ebiten.IsKeyPressed(ebiten.KeyControl) && inpututil.IsKeyJustPressed(ebiten.KeyC) && ui.Selection != nil {
+		ui.Clipboard = ui.Map.Copy(*ui.Selection, nil)
+	} else if ebiten.IsKeyPressed(ebiten.KeyControl) && inpututil.IsKeyJustPressed(ebiten.KeyX) && ui.Selection != nil {
+		ui.Clipboard = ui.Map.Copy(*ui.Selection, nil)
+		ui.Map.Erase(*ui.Selection)
+	} else if ebiten.IsKeyPressed(ebiten.KeyControl) && inpututil.IsKeyJustPressed(ebiten.KeyV) && ui.Clipboard != nil {
+		ui.Pasting = true
+		ui.TileSelector.Clear()
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		if ui.Generation != nil {
+			// cancel the preview, leaving the selection in place
+			ui.Generation = nil
+		} else if ui.Pasting {
+			ui.Pasting = false
+		} else {
+			ui.TileSelector.Clear()
+			ui.Selection = nil
+		}
+	} else if ui.Generation != nil {
+		if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+			ui.Generation.Paused = !ui.Generation.Paused
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyN) && ui.Generation.Paused {
+			ui.Generation.Step(1)
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyEnter) && ui.Generation.Finished {
+			if err := ui.Map.Accept(ui.Generation); err != nil {
+				log.Println(err)
+			} else if err := ui.Map.Save("map.json"); err != nil {
+				log.Fatal(err)
+			}
+			ui.Generation = nil
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyH) {
+			ui.Heatmap = !ui.Heatmap
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft) && ui.StepsPerFrame > 1 {
+			ui.StepsPerFrame /= 2
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyBracketRight) {
+			ui.StepsPerFrame *= 2
+		}
+	} else if ui.Selection != nil {
+		if inpututil.IsKeyJustPressed(ebiten.KeyG) {
+			gen, err := ui.Map.NewGeneration(ui.generateLayers(), *ui.Selection, ui.Algorithm, ui.Options[ui.Algorithm], time.Now().UnixMilli())
+			if err != nil {
+				log.Println(err)
+			}
+			ui.Generation = gen
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyDelete) || inpututil.IsKeyJustPressed(ebiten.KeyBackspace) {
+			ui.Map.Erase(*ui.Selection)
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyB) {
+			// use the selected region of the map as a stamp brush
+			ui.TileSelector.Clear()
+			ui.TileSelector.Stamp = ui.Map.Copy(*ui.Selection, nil)
+			ui.Selection = nil
+		}
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyUp) {
+		ui.OffsetY++
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyDown) {
+		ui.OffsetY--
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
+		ui.OffsetX++
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyRight) {
+		ui.OffsetX--
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyA) {
+		ui.nextAlgorithm()
+	}
+	if tile := ui.TileSelector.Selected; tile != nil && ui.TileSelector.Stamp == nil && ui.TileSelector.Random.Len() == 0 {
+		// turn or mirror the tile being painted
+		if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+			ui.TileSelector.Selected = &core.Tile{Spritesheet: tile.Spritesheet, Index: tile.Index, Flip: core.RotateClockwise.Compose(tile.Flip)}
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyF) {
+			ui.TileSelector.Selected = &core.Tile{Spritesheet: tile.Spritesheet, Index: tile.Index, Flip: core.FlipHorizontal.Compose(tile.Flip)}
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+		game.SetScene(NewExplore(ui.Map, ui.newWorld()))
+	}
+}
+
+// paint applies the current brush at x, y during a stroke. Stamps are laid out on a grid starting where the
+// stroke started so dragging repeats them seamlessly, and random tiles are only chosen once per cell.
+func (ui *Editor) paint(x, y int) {
+	p := image.Pt(x, y)
+	if s := ui.TileSelector.Stamp; s != nil {
+		d := p.Sub(ui.strokeStart)
+		p = ui.strokeStart.Add(image.Pt(floorDiv(d.X, s.Width)*s.Width, floorDiv(d.Y, s.Height)*s.Height))
+		if !ui.painted[p] {
+			ui.Map.Paste(s, p.X, p.Y, ui.Layer)
+		}
+	} else if ui.TileSelector.Random.Len() > 0 {
+		if !ui.painted[p] {
+			ui.Map.SetTile(ui.Layer, ui.TileSelector.Random.Pick(ui.rng), x, y)
+		}
+	} else {
+		ui.Map.SetTile(ui.Layer, ui.TileSelector.Selected, x, y)
+	}
+	ui.painted[p] = true
+}
+
+func floorDiv(a, b int) int {
+	if b <= 0 {
+		return a
+	}
+	return int(math.Floor(float64(a) / float64(b)))
+}
+
 func (ui *Editor) DrawSelectedTiles(event *bento.Event) {
 	if ui.TileSelector.Selected == nil {
 		return
@@ -222,24 +486,415 @@ func (ui *Editor) DrawSelectedTiles(event *bento.Event) {
 		op)
 }
 
+// Symmetry is the symmetry class of the selected tile
+func (ui *Editor) Symmetry() string {
+	if s := ui.Map.Symmetry(ui.TileSelector.Selected).String(); s != "" {
+		return s
+	}
+	return "none"
+}
+
+// Frames is the animation of the selected tile, see core.ParseAnimation
+func (ui *Editor) Frames() string {
+	tile := ui.TileSelector.Selected
+	return ui.TileSelector.draft("frames", ui.Map.Animation(tile).String())
+}
+
+// SetFrames animates the selected tile with the frames typed once they make sense, or stops animating it if there
+// are none, saving the manifest
+func (ui *Editor) SetFrames(event *bento.Event) {
+	ui.TileSelector.setDraft("frames", event.Value)
+	tile := ui.TileSelector.Selected
+	sheet := ui.Map.Spritesheets[tile.Spritesheet]
+	a, err := core.ParseAnimation(event.Value)
+	if err != nil || sheet == nil {
+		return
+	}
+	for _, f := range a {
+		if f.Index >= sheet.Len() {
+			return
+		}
+	}
+	sheet.SetAnimation(tile.Index, a)
+	ui.Map.Chunks.Reset()
+	// animations belong to the spritesheet, so are kept in the manifest
+	if err := ui.Map.SaveManifest(); err != nil {
+		log.Println(err)
+	}
+	ui.saveMap()
+}
+
+// CycleSymmetry sets the selected tile to the next symmetry class
+func (ui *Editor) CycleSymmetry(event *bento.Event) {
+	tile := ui.TileSelector.Selected
+	sheet := ui.Map.Spritesheets[tile.Spritesheet]
+	current := sheet.Symmetry(tile.Index)
+	for i, class := range core.SymmetryClasses {
+		if class == current {
+			sheet.SetSymmetry(tile.Index, core.SymmetryClasses[(i+1)%len(core.SymmetryClasses)])
+			break
+		}
+	}
+	// symmetries belong to the spritesheet, so are kept in the manifest
+	if err := ui.Map.SaveManifest(); err != nil {
+		log.Println(err)
+	}
+	ui.saveMap()
+}
+
+type socketRow struct {
+	Dir   int
+	Name  string
+	Label string
+}
+
+// Sockets are the edge labels of the selected tile, one row per direction
+func (ui *Editor) Sockets() []socketRow {
+	tile := ui.TileSelector.Selected
+	if tile == nil {
+		return nil
+	}
+	socket := ui.Map.Spritesheets[tile.Spritesheet].Sockets[tile.Index]
+	var rows []socketRow
+	for _, d := range ui.Map.Grid.Directions() {
+		rows = append(rows, socketRow{Dir: int(d), Name: d.String(), Label: socket[d]})
+	}
+	return rows
+}
+
+// SetSocket labels an edge of the selected tile, saving the spritesheet's sockets file
+func (ui *Editor) SetSocket(event *bento.Event) {
+	tile := ui.TileSelector.Selected
+	dir, err := strconv.Atoi(event.Box.Attrs["dir"])
+	if tile == nil || err != nil {
+		return
+	}
+	sheet := ui.Map.Spritesheets[tile.Spritesheet]
+	sheet.SetSocket(tile.Index, core.Direction(dir), event.Value)
+	if err := sheet.SaveSockets(); err != nil {
+		log.Println(err)
+	}
+}
+
+// CycleProjection switches the map to the next projection
+func (ui *Editor) CycleProjection(event *bento.Event) {
+	for i, p := range core.Projections {
+		if p == ui.Map.Projection {
+			ui.Map.Projection = core.Projections[(i+1)%len(core.Projections)]
+			break
+		}
+	}
+	ui.saveMap()
+}
+
+// CycleGrid switches the map to the next grid
+func (ui *Editor) CycleGrid(event *bento.Event) {
+	for i, g := range core.Grids {
+		if g == ui.Map.Grid {
+			ui.Map.Grid = core.Grids[(i+1)%len(core.Grids)]
+			break
+		}
+	}
+	ui.saveMap()
+}
+
+func (ui *Editor) nextAlgorithm() {
+	names := core.AlgorithmNames()
+	for i, name := range names {
+		if name == ui.Algorithm {
+			ui.Algorithm = names[(i+1)%len(names)]
+			return
+		}
+	}
+	ui.Algorithm = names[0]
+}
+
+func (ui *Editor) Algorithms() []string {
+	return core.AlgorithmNames()
+}
+
+type paramValue struct {
+	Name  string
+	Value int
+}
+
+// Params lists the parameters of the selected algorithm along with their current values
+func (ui *Editor) Params() []paramValue {
+	a, err := core.LookupAlgorithm(ui.Algorithm)
+	if err != nil {
+		return nil
+	}
+	opts := a.Options(ui.Options[ui.Algorithm])
+	var params []paramValue
+	for _, p := range a.Params {
+		params = append(params, paramValue{Name: p.Name, Value: opts[p.Name]})
+	}
+	return params
+}
+
+func (ui *Editor) SelectAlgorithm(event *bento.Event) {
+	ui.Algorithm = event.Box.Attrs["algorithm"]
+}
+
+func (ui *Editor) IncrementParam(event *bento.Event) {
+	ui.adjustParam(event.Box.Attrs["param"], 1)
+}
+
+func (ui *Editor) DecrementParam(event *bento.Event) {
+	ui.adjustParam(event.Box.Attrs["param"], -1)
+}
+
+func (ui *Editor) adjustParam(name string, delta int) {
+	a, err := core.LookupAlgorithm(ui.Algorithm)
+	if err != nil {
+		return
+	}
+	opts := a.Options(ui.Options[ui.Algorithm])
+	opts[name] += delta
+	ui.Options[ui.Algorithm] = a.Options(opts)
+}
+
+type layerRow struct {
+	Active   bool
+	Generate bool
+	*core.Layer
+}
+
+// LayerRows lists the layers of the map from the top down, as they are shown in the layer panel
+func (ui *Editor) LayerRows() []layerRow {
+	var rows []layerRow
+	for i := len(ui.Map.Layers) - 1; i >= 0; i-- {
+		l := ui.Map.Layers[i]
+		rows = append(rows, layerRow{Active: l.Name == ui.Layer, Generate: !ui.skipLayers[l.Name], Layer: l})
+	}
+	return rows
+}
+
+// newWorld generates the map endlessly around what has been drawn, from the map's world seed so exploring the same
+// map again finds the same world
+func (ui *Editor) newWorld() *core.World {
+	if ui.Map.WorldSeed == 0 {
+		ui.Map.WorldSeed = time.Now().UnixMilli()
+	}
+	world, err := core.NewWorld(ui.Map.Map, ui.generateLayers(), ui.Algorithm, ui.Options[ui.Algorithm], ui.Map.WorldSeed)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return world
+}
+
+// generateLayers is the layers learned from and written to by generation, all unless toggled off in the panel
+func (ui *Editor) generateLayers() []string {
+	var names []string
+	for _, l := range ui.Map.Layers {
+		if !ui.skipLayers[l.Name] {
+			names = append(names, l.Name)
+		}
+	}
+	return names
+}
+
+func (ui *Editor) SelectLayer(event *bento.Event) {
+	ui.Layer = event.Box.Attrs["layer"]
+}
+
+func (ui *Editor) ToggleLayerVisible(event *bento.Event) {
+	if l := ui.Map.Layer(event.Box.Attrs["layer"]); l != nil {
+		l.Visible = !l.Visible
+		ui.saveMap()
+	}
+}
+
+func (ui *Editor) ToggleLayerLocked(event *bento.Event) {
+	if l := ui.Map.Layer(event.Box.Attrs["layer"]); l != nil {
+		l.Locked = !l.Locked
+		ui.saveMap()
+	}
+}
+
+// ToggleLayerUpright stands the tiles of a layer up in projected views, or lays them flat
+func (ui *Editor) ToggleLayerUpright(event *bento.Event) {
+	if l := ui.Map.Layer(event.Box.Attrs["layer"]); l != nil {
+		l.Upright = !l.Upright
+		ui.saveMap()
+	}
+}
+
+func (ui *Editor) ToggleLayerGenerate(event *bento.Event) {
+	name := event.Box.Attrs["layer"]
+	ui.skipLayers[name] = !ui.skipLayers[name]
+}
+
+func (ui *Editor) IncrementLayerOpacity(event *bento.Event) {
+	ui.adjustLayerOpacity(event.Box.Attrs["layer"], 0.1)
+}
+
+func (ui *Editor) DecrementLayerOpacity(event *bento.Event) {
+	ui.adjustLayerOpacity(event.Box.Attrs["layer"], -0.1)
+}
+
+func (ui *Editor) adjustLayerOpacity(name string, delta float64) {
+	if l := ui.Map.Layer(name); l != nil {
+		l.Opacity = math.Round(math.Min(math.Max(l.Opacity+delta, 0), 1)*10) / 10
+		ui.saveMap()
+	}
+}
+
+func (ui *Editor) RaiseLayer(event *bento.Event) {
+	ui.Map.MoveLayer(event.Box.Attrs["layer"], 1)
+	ui.saveMap()
+}
+
+func (ui *Editor) LowerLayer(event *bento.Event) {
+	ui.Map.MoveLayer(event.Box.Attrs["layer"], -1)
+	ui.saveMap()
+}
+
+func (ui *Editor) AddLayer(event *bento.Event) {
+	ui.Layer = ui.Map.AddLayer(ui.Map.NewLayerName()).Name
+	ui.saveMap()
+}
+
+// RemoveLayer deletes the active layer, as long as it isn't the last one
+func (ui *Editor) RemoveLayer(event *bento.Event) {
+	if len(ui.Map.Layers) < 2 {
+		return
+	}
+	ui.Map.RemoveLayer(ui.Layer)
+	delete(ui.skipLayers, ui.Layer)
+	ui.Layer = ui.Map.Layers[len(ui.Map.Layers)-1].Name
+	ui.saveMap()
+}
+
+func (ui *Editor) saveMap() {
+	if err := ui.Map.Save("map.json"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// mapOffset is how far the map is panned in pixels, in whole tiles
+func (ui *Editor) mapOffset() (float64, float64) {
+	w, h := float64(ui.Map.TileWidth), float64(ui.Map.TileHeight)
+	return math.Floor(ui.OffsetX/w) * w, math.Floor(ui.OffsetY/h) * h
+}
+
+// view places the projected map on the canvas, panned and scaled
+func (ui *Editor) view(event *bento.Event) ebiten.GeoM {
+	var g ebiten.GeoM
+	g.Translate(ui.mapOffset())
+	g.Translate(float64(event.Box.X), float64(event.Box.Y))
+	g.Scale(ui.MapScale, ui.MapScale)
+	return g
+}
+
+// mapTilePos is the cell under x, y on the map canvas
 func (ui *Editor) mapTilePos(x, y int) (int, int) {
 	w, h := float64(ui.Map.TileWidth), float64(ui.Map.TileHeight)
-	ox, oy := math.Floor(ui.OffsetX/w), math.Floor(ui.OffsetY/h)
-	return int(math.Floor(float64(x)/(w*ui.MapScale)) - ox), int(math.Floor(float64(y)/(h*ui.MapScale)) - oy)
+	ox, oy := ui.mapOffset()
+	px, py := ui.Map.Projection.Unproject(float64(x)/ui.MapScale-ox, float64(y)/ui.MapScale-oy, w, h)
+	return ui.Map.Grid.Cell(px, py, w, h)
 }
 
 func (ui *Editor) UI() string {
 	return `<col grow="1">
 		<row grow="1">
 			<col grow="1">
-				<canvas grow="1" onDraw="Draw" onClick="Click" onHover="Hover" onScroll="OnMapScroll" />
+				<canvas grow="1" onDraw="Draw" onClick="Click" onHover="Hover" onUpdate="Update" onScroll="OnMapScroll" />
 			</col>
 		</row>
 		<col float="true" justifySelf="start end" margin="16px">
 			{{ if ne .TileSelector.Selected nil }}
-				<text font="RobotoMono 14" color="#ffffff">{{ .TileSelector.Selected.Spritesheet }} {{ .TileSelector.Selected.Index }}</text>
+				<row justify="start center">
+					<text font="RobotoMono 14" color="#ffffff">{{ .TileSelector.Selected.Spritesheet }} {{ .TileSelector.Selected.Index }}</text>
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="CycleSymmetry">symmetry {{ .Symmetry }}</button>
+				</row>
+				{{ range .Sockets }}
+					<row justify="start center">
+						<text font="RobotoMono 14" color="#ffffff">{{ .Name }}</text>
+						<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="96px" onClick="Focus" onChange="SetSocket" dir="{{ .Dir }}" value="{{ .Label }}" />
+					</row>
+				{{ end }}
+				<row justify="start center">
+					<text font="RobotoMono 14" color="#ffffff">frames</text>
+					<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="192px" onClick="Focus" onChange="SetFrames" value="{{ .Frames }}" />
+				</row>
+			{{ end }}
+			{{ if .Pasting }}
+				<text font="RobotoMono 14" color="#ffffff">pasting {{ .Clipboard.Width }}x{{ .Clipboard.Height }}, escape to stop</text>
+			{{ else if ne .TileSelector.Stamp nil }}
+				<text font="RobotoMono 14" color="#ffffff">stamp {{ .TileSelector.Stamp.Width }}x{{ .TileSelector.Stamp.Height }}</text>
+			{{ else if gt .TileSelector.Random.Len 0 }}
+				<text font="RobotoMono 14" color="#ffffff">random {{ .TileSelector.Random.Len }} tiles</text>
+			{{ end }}
+			<row justify="start center">
+				<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="CycleGrid">grid {{ .Map.Grid }}</button>
+				<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="CycleProjection">{{ .Map.Projection }}</button>
+				<text font="RobotoMono 14" color="#ffffff">{{ .HoverX }}, {{ .HoverY }}</text>
+			</row>
+			<row justify="start center">
+				{{ range .Algorithms }}
+					<button
+							font="RobotoMono 14"
+							btn="ui/button.png 6"
+							color="{{ if eq . $.Algorithm }}#ffff00{{ else }}#ffffff{{ end }}"
+							padding="4px"
+							onClick="SelectAlgorithm"
+							algorithm="{{ . }}"
+					>{{ . }}</button>
+				{{ end }}
+			</row>
+			{{ range .Params }}
+				<row justify="start center">
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="DecrementParam" param="{{ .Name }}">-</button>
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="IncrementParam" param="{{ .Name }}">+</button>
+					<text font="RobotoMono 14" color="#ffffff">{{ .Name }} {{ .Value }}</text>
+				</row>
+			{{ end }}
+			{{ range .LayerRows }}
+				<row justify="start center">
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="ToggleLayerVisible" layer="{{ .Name }}">{{ if .Visible }}o{{ else }}-{{ end }}</button>
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="ToggleLayerLocked" layer="{{ .Name }}">{{ if .Locked }}L{{ else }}-{{ end }}</button>
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="ToggleLayerGenerate" layer="{{ .Name }}">{{ if .Generate }}G{{ else }}-{{ end }}</button>
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="ToggleLayerUpright" layer="{{ .Name }}">{{ if .Upright }}U{{ else }}-{{ end }}</button>
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="DecrementLayerOpacity" layer="{{ .Name }}">-</button>
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="IncrementLayerOpacity" layer="{{ .Name }}">+</button>
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="RaiseLayer" layer="{{ .Name }}">^</button>
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="LowerLayer" layer="{{ .Name }}">v</button>
+					<button
+							font="RobotoMono 14"
+							btn="ui/button.png 6"
+							color="{{ if .Active }}#ffff00{{ else }}#ffffff{{ end }}"
+							padding="4px"
+							onClick="SelectLayer"
+							layer="{{ .Name }}"
+					>{{ .Name }} {{ printf "%.1f" .Opacity }}</button>
+				</row>
 			{{ end }}
-			<text font="RobotoMono 14" color="#ffffff">{{ .HoverX }}, {{ .HoverY }}</text>
+			<row justify="start center">
+				<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="AddLayer">add layer</button>
+				<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="RemoveLayer">remove layer</button>
+			</row>
+			{{ range .Records }}
+				<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="Rerun" record="{{ .Index }}">rerun {{ .Algorithm }} seed {{ .Seed }} at {{ .Rect }}</button>
+			{{ end }}
+			{{ with .Generation }}
+				<row justify="start center">
+					<text font="RobotoMono 14" color="#ffffff">{{ .Algorithm }} seed</text>
+					<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="192px" onClick="Focus" onChange="SetSeed" value="{{ .Seed }}" />
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="Reroll">reroll</button>
+				</row>
+				<text font="RobotoMono 14" color="#ffffff">step {{ .Steps }}{{ with .Constraints }} {{ len . }} constraints{{ end }}{{ if .Paused }} paused{{ end }}</text>
+				{{ if .Err }}
+					<text font="RobotoMono 14" color="#ff0000">{{ .Err }}</text>
+				{{ else if .Finished }}
+					<text font="RobotoMono 14" color="#ffffff">enter to accept, escape to reject</text>
+				{{ end }}
+			{{ end }}
+		</col>
+		<col float="true" justifySelf="start start" margin="16px">
+			<RuleEditor zIndex="100" />
+			<TilesetEditor zIndex="100" />
 		</col>
 		<col float="true" justifySelf="end" margin="16px">
 			<TileSelector zIndex="100" />
@@ -1,70 +1,164 @@
 package main
 
 import (
+	"image"
+	"log"
+	"math"
+
 	"github.com/etherealmachine/bento"
 	"github.com/hajimehoshi/ebiten/v2"
+
+	"weave/core"
+)
+
+const (
+	// exploreRadius is how many chunks around the character's are generated ahead of it
+	exploreRadius = 1
+	// stepFrames is how many frames the character takes to walk from one cell to the next
+	stepFrames = 8
 )
 
 type Explore struct {
 	Map       *Map
 	MapScale  float64
 	Character *Character
+	// World, if not nil, generates the map around the character as it explores
+	World *core.World
 }
 
+// Character walks the map a cell at a time, only onto cells that are walkable
 type Character struct {
 	TileX, TileY int
-	Sprite       *ebiten.Image
+	Tile         *core.Tile
+	// FromX, FromY is the cell the character is walking from, and Step how far it is from there, from 0 to 1
+	FromX, FromY int
+	Step         float64
 }
 
-func NewExplore(m *Map) *Explore {
-	return &Explore{Map: m, MapScale: 1, Character: &Character{
-		Sprite: m.Image(&Tile{Spritesheet: "characters.png", Index: 529}),
+func NewExplore(m *Map, world *core.World) *Explore {
+	ui := &Explore{Map: m, MapScale: 1, World: world, Character: &Character{
+		Tile: &core.Tile{Spritesheet: "tilesets/characters.png", Index: 529},
+		Step: 1,
 	}}
+	ui.place()
+	return ui
 }
 
-func (ui *Explore) Draw(event *bento.Event) {
-	ui.drawMap(event)
-	op := new(ebiten.DrawImageOptions)
-	op.GeoM.Translate(float64(event.Box.X), float64(event.Box.Y))
-	op.GeoM.Scale(ui.MapScale, ui.MapScale)
-	event.Image.DrawImage(ui.Character.Sprite, op)
-}
-
-func (ui *Explore) drawMap(event *bento.Event) {
-	w, h := float64(ui.Map.TileWidth), float64(ui.Map.TileHeight)
-	ox, oy := float64(ui.Character.TileX), float64(ui.Character.TileY)
-	for x, ys := range ui.Map.Tilemap {
-		for y, tiles := range ys {
-			for _, tile := range tiles {
-				img := ui.Map.Image(tile)
-				op := new(ebiten.DrawImageOptions)
-				op.GeoM.Translate(float64(event.Box.X), float64(event.Box.Y))
-				op.GeoM.Translate(float64(x)*w, float64(y)*h)
-				op.GeoM.Translate(ox, oy)
-				op.GeoM.Scale(ui.MapScale, ui.MapScale)
-				//op.GeoM.Skew(-0.7, 0)
-				event.Image.DrawImage(img, op)
+// place moves the character to the first walkable cell of the map, from the top down, unless it stands on one
+func (ui *Explore) place() {
+	c := ui.Character
+	if ui.Map.Walkable(c.TileX, c.TileY) {
+		return
+	}
+	var bounds image.Rectangle
+	for _, l := range ui.Map.Layers {
+		bounds = bounds.Union(l.Tilemap.Bounds())
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if ui.Map.Walkable(x, y) {
+				c.TileX, c.TileY, c.FromX, c.FromY = x, y, x, y
+				return
 			}
 		}
 	}
 }
 
-func (ui *Explore) Click(event *bento.Event) {
+// Update walks the character, and generates any chunks around it that haven't been yet
+func (ui *Explore) Update() bool {
+	c := ui.Character
+	changed := c.Step < 1
+	if c.Step < 1 {
+		c.Step = math.Min(c.Step+1/float64(stepFrames), 1)
+	}
+	if c.Step == 1 {
+		// holding a key keeps walking
+		changed = ui.walk() || changed
+	}
+	if ui.World == nil {
+		return changed
+	}
+	chunks, err := ui.World.Around(c.TileX, c.TileY, exploreRadius)
+	if err != nil {
+		log.Println(err)
+	}
+	for _, chunk := range chunks {
+		ui.Map.Chunks.Invalidate(core.ChunkRect(chunk))
+	}
+	return changed || len(chunks) > 0
 }
 
-func (ui *Explore) Hover(event *bento.Event) {
+// walk starts the character towards the neighboring cell in the direction of the arrow keys held, returning false
+// if none are or the way is blocked
+func (ui *Explore) walk() bool {
+	var dx, dy float64
 	if ebiten.IsKeyPressed(ebiten.KeyUp) {
-		ui.Character.TileY++
+		dy--
 	}
 	if ebiten.IsKeyPressed(ebiten.KeyDown) {
-		ui.Character.TileY--
+		dy++
 	}
 	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
-		ui.Character.TileX++
+		dx--
 	}
 	if ebiten.IsKeyPressed(ebiten.KeyRight) {
-		ui.Character.TileX--
+		dx++
 	}
+	if dx == 0 && dy == 0 {
+		return false
+	}
+	c := ui.Character
+	m := ui.Map
+	w, h := float64(m.TileWidth), float64(m.TileHeight)
+	px, py := m.Grid.Position(c.TileX, c.TileY, w, h)
+	// the neighbor in the direction closest to the keys, which on hexagonal grids may be diagonal
+	best, nx, ny := 0.0, 0, 0
+	for _, d := range m.Grid.Directions() {
+		x, y := m.Grid.Neighbor(c.TileX, c.TileY, d)
+		qx, qy := m.Grid.Position(x, y, w, h)
+		ox, oy := qx-px, qy-py
+		if dot := (ox*dx + oy*dy) / math.Hypot(ox, oy) / math.Hypot(dx, dy); dot > best+1e-9 {
+			best, nx, ny = dot, x, y
+		}
+	}
+	if best == 0 || !m.Walkable(nx, ny) {
+		return false
+	}
+	c.FromX, c.FromY = c.TileX, c.TileY
+	c.TileX, c.TileY = nx, ny
+	c.Step = 0
+	return true
+}
+
+// offset is how far the character is from its cell in top down pixels as it walks there
+func (ui *Explore) offset() (float64, float64) {
+	c := ui.Character
+	m := ui.Map
+	w, h := float64(m.TileWidth), float64(m.TileHeight)
+	fx, fy := m.Grid.Position(c.FromX, c.FromY, w, h)
+	tx, ty := m.Grid.Position(c.TileX, c.TileY, w, h)
+	return (fx - tx) * (1 - c.Step), (fy - ty) * (1 - c.Step)
+}
+
+func (ui *Explore) Draw(event *bento.Event) {
+	ui.drawMap(event)
+}
+
+// drawMap draws the map centered on the character, who is depth sorted along with any upright layers
+func (ui *Explore) drawMap(event *bento.Event) {
+	c := ui.Character
+	sprite := core.Sprite{X: c.TileX, Y: c.TileY, Layer: len(ui.Map.Layers), Tile: c.Tile}
+	sprite.OffsetX, sprite.OffsetY = ui.offset()
+	var view ebiten.GeoM
+	cx, cy := ui.Map.cellCenter(c.TileX, c.TileY)
+	ox, oy := ui.Map.Projection.Project(sprite.OffsetX, sprite.OffsetY, float64(ui.Map.TileWidth), float64(ui.Map.TileHeight))
+	view.Translate(-cx-ox, -cy-oy)
+	view.Scale(ui.MapScale, ui.MapScale)
+	view.Translate(float64(event.Box.X+event.Box.InnerWidth/2), float64(event.Box.Y+event.Box.InnerHeight/2))
+	ui.Map.DrawLayers(event.Image, view, []core.Sprite{sprite})
+}
+
+func (ui *Explore) Click(event *bento.Event) {
 }
 
 func (ui *Explore) OnMapScroll(event *bento.Event) bool {
@@ -81,6 +175,6 @@ func (ui *Explore) OnMapScroll(event *bento.Event) bool {
 
 func (ui *Explore) UI() string {
 	return `<col grow="1">
-		<canvas grow="1" onDraw="Draw" onClick="Click" onHover="Hover" onScroll="OnMapScroll" />
+		<canvas grow="1" onDraw="Draw" onClick="Click" onUpdate="Update" onScroll="OnMapScroll" />
 	</col>`
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"image"
+
+	"github.com/etherealmachine/bento"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// Keyboard tracks whether a text input has focus, so hotkeys don't fire while typing into it. Inputs report being
+// clicked with onClick="Focus", and clicking anywhere else takes the focus away, as it does for the input itself.
+type Keyboard struct {
+	input  image.Rectangle
+	typing bool
+}
+
+// Focus is the onClick handler of inputs
+func (k *Keyboard) Focus(event *bento.Event) {
+	k.input = event.Box.Bounds()
+	k.typing = true
+}
+
+// Typing is true while an input has focus
+func (k *Keyboard) Typing() bool {
+	return k.typing
+}
+
+// update drops the focus once the mouse is pressed outside the focused input, called every frame
+func (k *Keyboard) update() {
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		k.typing = image.Pt(ebiten.CursorPosition()).In(k.input)
+	}
+}
@@ -1,24 +1,27 @@
 package main
 
 import (
-	"encoding/json"
 	"image"
 	"log"
-	"os"
+
+	"github.com/hajimehoshi/ebiten/v2"
+
+	"weave/core"
 )
 
 type Map struct {
-	*Tileset
-	TileWidth, TileHeight int
-	Tilemap               Tilemap
+	*core.Map
+	History  *core.History `json:"-"`
+	Textures *Textures     `json:"-"`
+	Chunks   *Chunks       `json:"-"`
 }
 
-func NewMap(w, h int, tileset *Tileset) *Map {
+func NewMap(w, h int, tileset *core.Tileset) *Map {
 	t := &Map{
-		TileWidth:  w,
-		TileHeight: h,
-		Tileset:    tileset,
-		Tilemap:    make(map[int]map[int]Stack),
+		Map:      core.NewMap(w, h, tileset),
+		History:  core.NewHistory(core.DefaultHistorySize),
+		Textures: NewTextures(tileset),
+		Chunks:   NewChunks(),
 	}
 	/*
 		if err := t.Load("map.json"); err != nil {
@@ -28,113 +31,276 @@ func NewMap(w, h int, tileset *Tileset) *Map {
 	return t
 }
 
-func (m *Map) Save(filename string) error {
-	m.Cleanup()
-	f, err := os.Create(filename)
-	if err != nil {
-		return err
+func (m *Map) Image(t *core.Tile) *ebiten.Image {
+	return m.Textures.Image(t)
+}
+
+// projection is the map's projection as a transform of top down pixels
+func (m *Map) projection() ebiten.GeoM {
+	a, b, c, d := m.Projection.Matrix(float64(m.TileWidth), float64(m.TileHeight))
+	var g ebiten.GeoM
+	g.SetElement(0, 0, a)
+	g.SetElement(0, 1, b)
+	g.SetElement(1, 0, c)
+	g.SetElement(1, 1, d)
+	return g
+}
+
+// cellGeoM places the tileWidth x tileHeight box of the cell at x, y on the projected map
+func (m *Map) cellGeoM(x, y int) ebiten.GeoM {
+	var g ebiten.GeoM
+	g.Translate(m.Grid.Position(x, y, float64(m.TileWidth), float64(m.TileHeight)))
+	g.Concat(m.projection())
+	return g
+}
+
+// cellCenter is where the center of the cell at x, y is on the projected map
+func (m *Map) cellCenter(x, y int) (float64, float64) {
+	w, h := float64(m.TileWidth), float64(m.TileHeight)
+	px, py := m.Grid.Position(x, y, w, h)
+	return m.Projection.Project(px+w/2, py+h/2, w, h)
+}
+
+// DrawLayers draws the visible layers of the map within the bounds of dst, with view placing the projected map on
+// dst. Layers are drawn in order when viewed top down, followed by sprites. Otherwise the flat layers are drawn
+// first, and the tiles of upright layers stand up at their cells along with sprites, from back to front.
+func (m *Map) DrawLayers(dst *ebiten.Image, view ebiten.GeoM, sprites []core.Sprite) {
+	m.Chunks.sync(m.Grid)
+	cells := m.visibleCells(dst.Bounds(), view)
+	projected := m.Projection != core.ProjectionTopDown
+	for _, l := range m.Layers {
+		if !l.Visible || (projected && l.Upright) {
+			continue
+		}
+		for _, chunk := range m.Chunks.Visible(l, cells) {
+			m.drawChunk(dst, l, chunk, view)
+		}
 	}
-	enc := json.NewEncoder(f)
-	if err := enc.Encode(m); err != nil {
-		return err
+	if !projected {
+		for _, s := range sprites {
+			m.DrawTile(dst, s.Tile, s.X, s.Y, m.spriteView(s, view), 1)
+		}
+		return
+	}
+	var upright []core.Sprite
+	for i, l := range m.Layers {
+		if !l.Visible || !l.Upright {
+			continue
+		}
+		for _, chunk := range m.Chunks.Visible(l, cells) {
+			rect := core.ChunkRect(chunk)
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				for x := rect.Min.X; x < rect.Max.X; x++ {
+					for _, tile := range l.Tilemap.Get(x, y) {
+						upright = append(upright, core.Sprite{X: x, Y: y, Layer: i, Tile: tile})
+					}
+				}
+			}
+		}
+	}
+	sprites = append(upright, sprites...)
+	m.DepthSort(sprites)
+	for _, s := range sprites {
+		opacity := 1.0
+		if s.Layer < len(m.Layers) {
+			opacity = m.Layers[s.Layer].Opacity
+		}
+		m.DrawSprite(dst, s.Tile, s.X, s.Y, m.spriteView(s, view), opacity)
 	}
-	return nil
 }
 
-func (m *Map) Load(filename string) error {
-	f, err := os.Open(filename)
-	if os.IsNotExist(err) {
-		return nil
-	} else if err != nil {
-		return err
+// spriteView is view moved by the projected offset of s from its cell
+func (m *Map) spriteView(s core.Sprite, view ebiten.GeoM) ebiten.GeoM {
+	var g ebiten.GeoM
+	g.Translate(m.Projection.Project(s.OffsetX, s.OffsetY, float64(m.TileWidth), float64(m.TileHeight)))
+	g.Concat(view)
+	return g
+}
+
+// drawChunk draws a chunk of a flat layer, from its cached image if caching is on
+func (m *Map) drawChunk(dst *ebiten.Image, l *core.Layer, chunk image.Point, view ebiten.GeoM) {
+	rect := core.ChunkRect(chunk)
+	if !m.Chunks.Cache || m.Chunks.animated(m, l, chunk) {
+		geom := m.projection()
+		geom.Concat(view)
+		m.drawCells(dst, l, rect, geom, l.Opacity)
+		return
 	}
-	d := json.NewDecoder(f)
-	if err := d.Decode(m); err != nil {
-		return err
+	img, offset := m.Chunks.image(m, l, chunk)
+	if img == nil {
+		return
+	}
+	op := new(ebiten.DrawImageOptions)
+	op.GeoM.Translate(float64(offset.X), float64(offset.Y))
+	op.GeoM.Concat(m.cellGeoM(rect.Min.X, rect.Min.Y))
+	op.GeoM.Concat(view)
+	op.ColorM.Scale(1, 1, 1, l.Opacity)
+	dst.DrawImage(img, op)
+}
+
+// visibleCells is the cells drawn within bounds, with a chunk to spare on every side for tiles that overhang them
+func (m *Map) visibleCells(bounds image.Rectangle, view ebiten.GeoM) image.Rectangle {
+	g := m.projection()
+	g.Concat(view)
+	if !g.IsInvertible() {
+		return image.Rectangle{}
+	}
+	g.Invert()
+	w, h := float64(m.TileWidth), float64(m.TileHeight)
+	var cells image.Rectangle
+	for i, corner := range []image.Point{bounds.Min, image.Pt(bounds.Max.X, bounds.Min.Y), bounds.Max, image.Pt(bounds.Min.X, bounds.Max.Y)} {
+		px, py := g.Apply(float64(corner.X), float64(corner.Y))
+		x, y := m.Grid.Cell(px, py, w, h)
+		cell := image.Rect(x, y, x+1, y+1)
+		if i == 0 {
+			cells = cell
+		} else {
+			cells = cells.Union(cell)
+		}
+	}
+	return cells.Inset(-core.ChunkSize)
+}
+
+// DrawTile draws tile lying flat on the cell at x, y, with view placing the projected map on dst
+func (m *Map) DrawTile(dst *ebiten.Image, tile *core.Tile, x, y int, view ebiten.GeoM, opacity float64) {
+	tile = m.Frame(tile, animationTime())
+	img := m.Image(tile)
+	if img == nil {
+		return
 	}
-	m.Cleanup()
-	return nil
+	op := new(ebiten.DrawImageOptions)
+	flipGeoM(op, tile.Flip, float64(img.Bounds().Dx()), float64(img.Bounds().Dy()))
+	anchor := m.Anchor(tile, m.TileWidth, m.TileHeight)
+	op.GeoM.Translate(float64(anchor.X), float64(anchor.Y))
+	op.GeoM.Concat(m.cellGeoM(x, y))
+	op.GeoM.Concat(view)
+	op.ColorM.Scale(1, 1, 1, opacity)
+	dst.DrawImage(img, op)
 }
 
-func (m *Map) SetTile() {
+// DrawSprite draws tile standing up on the cell at x, y, with the middle of its bottom edge on the cell's center
+func (m *Map) DrawSprite(dst *ebiten.Image, tile *core.Tile, x, y int, view ebiten.GeoM, opacity float64) {
+	tile = m.Frame(tile, animationTime())
+	img := m.Image(tile)
+	if img == nil {
+		return
+	}
+	w, h := float64(img.Bounds().Dx()), float64(img.Bounds().Dy())
+	op := new(ebiten.DrawImageOptions)
+	flipGeoM(op, tile.Flip, w, h)
+	if tile.Flip&core.FlipDiagonal != 0 {
+		w, h = h, w
+	}
+	offset := m.Offset(tile)
+	op.GeoM.Translate(-w/2+float64(offset.X), -h+float64(offset.Y))
+	op.GeoM.Translate(m.cellCenter(x, y))
+	op.GeoM.Concat(view)
+	op.ColorM.Scale(1, 1, 1, opacity)
+	dst.DrawImage(img, op)
+}
 
+// SetTile replaces the tile at x, y in the named layer, unless the layer is locked
+func (m *Map) SetTile(layer string, tile *core.Tile, x, y int) {
+	l := m.Layer(layer)
+	if l == nil || l.Locked || tile == nil {
+		return
+	}
+	before := l.Tilemap.Get(x, y).Clone()
+	l.Tilemap.Put(core.Stack{tile}, x, y)
+	m.Chunks.Invalidate(image.Rect(x, y, x+1, y+1))
+	if err := m.Save("map.json"); err != nil {
+		log.Fatal(err)
+	}
+	if after := l.Tilemap.Get(x, y); after.Hash() != before.Hash() {
+		m.History.Record(layer, x, y, before, after.Clone())
+	}
 }
 
+// Erase clears rect in every unlocked layer
 func (m *Map) Erase(rect image.Rectangle) {
-	for x := rect.Min.X; x < rect.Max.X; x++ {
-		for y := rect.Min.Y; y < rect.Max.Y; y++ {
-			if m.Tilemap[x] != nil {
-				m.Tilemap[x][y] = nil
+	m.History.Begin("erase")
+	for _, l := range m.Layers {
+		if l.Locked {
+			continue
+		}
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				if before := l.Tilemap.Get(x, y); len(before) > 0 {
+					m.History.Record(l.Name, x, y, before.Clone(), nil)
+					l.Tilemap.Put(nil, x, y)
+				}
 			}
 		}
 	}
+	m.History.Commit()
+	m.Chunks.Invalidate(rect)
 	if err := m.Save("map.json"); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func (m *Map) EraseTile(x, y int) {
-	if l := len(m.Tilemap[x][y]); l > 0 {
-		m.Tilemap[x][y] = m.Tilemap[x][y][:l-1]
-	}
+// Paste writes s into the map with its top left corner at x, y, see core.Map.Paste
+func (m *Map) Paste(s *core.Stamp, x, y int, layer string) {
+	m.Map.Paste(s, x, y, layer, m.History)
+	m.Chunks.Invalidate(image.Rect(x, y, x+s.Width, y+s.Height))
 	if err := m.Save("map.json"); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func (m *Map) Cleanup() {
-	for x, ys := range m.Tilemap {
-		for y, tiles := range ys {
-			var stack Stack
-			for _, tile := range tiles {
-				if tile == nil || tile.Index <= 0 || m.Spritesheets[tile.Spritesheet] == nil {
-					continue
-				}
-				if len(stack) > 0 {
-					prev := stack[len(stack)-1]
-					if prev.Spritesheet == tile.Spritesheet && prev.Index == tile.Index {
-						continue
-					}
-				}
-				stack = append(stack, tile)
-			}
-			m.Tilemap[x][y] = stack
-			if len(stack) == 0 {
-				delete(m.Tilemap[x], y)
-			}
+// EraseTile clears the tile at x, y in the named layer, unless the layer is locked
+func (m *Map) EraseTile(layer string, x, y int) {
+	l := m.Layer(layer)
+	if l == nil || l.Locked {
+		return
+	}
+	if before := l.Tilemap.Get(x, y); len(before) > 0 {
+		m.History.Record(layer, x, y, before.Clone(), nil)
+		l.Tilemap.Put(nil, x, y)
+		m.Chunks.Invalidate(image.Rect(x, y, x+1, y+1))
+		if err := m.Save("map.json"); err != nil {
+			log.Fatal(err)
 		}
-		if len(ys) == 0 {
-			delete(m.Tilemap, x)
+	}
+}
+
+func (m *Map) Undo() {
+	if m.History.Undo(m.Map) {
+		m.Chunks.Reset()
+		if err := m.Save("map.json"); err != nil {
+			log.Fatal(err)
 		}
 	}
 }
 
-func (m *Map) Generate(rect image.Rectangle, seed int64) {
-	subMap := make(map[int]map[int]Stack)
-	for x := rect.Min.X; x < rect.Max.X; x++ {
-		for y := rect.Min.Y; y < rect.Max.Y; y++ {
-			stack := m.Tilemap[x][y]
-			if stack != nil {
-				if subMap[x-rect.Min.X] == nil {
-					subMap[x-rect.Min.X] = make(map[int]Stack)
-				}
-				subMap[x-rect.Min.X][y-rect.Min.Y] = stack
-			}
+func (m *Map) Redo() {
+	if m.History.Redo(m.Map) {
+		m.Chunks.Reset()
+		if err := m.Save("map.json"); err != nil {
+			log.Fatal(err)
 		}
 	}
-	//g := NewWFC(Analyze(m.Tilemap), rect.Dx(), rect.Dy(), subMap, seed)
-	g := NewGreedyBFS(Analyze(m.Tilemap), rect.Dx(), rect.Dy(), subMap, seed)
-	for !g.Done() {
+}
+
+// Generate fills rect in the named layers using the named algorithm, blocking until it is done
+func (m *Map) Generate(layers []string, rect image.Rectangle, algorithm string, opts core.Options, seed int64) error {
+	gen, err := m.NewGeneration(layers, rect, algorithm, opts, seed)
+	if err != nil {
+		return err
 	}
-	result := g.Result()
-	for x := 0; x < len(result); x++ {
-		for y := 0; y < len(result[x]); y++ {
-			if result[x][y] != nil {
-				if len(m.Tilemap[x+rect.Min.X]) == 0 {
-					m.Tilemap[x+rect.Min.X] = make(map[int]Stack)
-				}
-				m.Tilemap[x+rect.Min.X][y+rect.Min.Y] = result[x][y]
-			}
-		}
+	for !gen.Step(1) {
 	}
+	return m.Accept(gen)
+}
+
+// NewGeneration starts generating rect in the named layers without modifying the map, see Generation.Step
+// and Map.Accept
+func (m *Map) NewGeneration(layers []string, rect image.Rectangle, algorithm string, opts core.Options, seed int64) (*core.Generation, error) {
+	return m.Map.NewGeneration(layers, rect, rect, algorithm, opts, seed)
+}
+
+// Accept writes the result of a finished generation into the map as a single undoable edit
+func (m *Map) Accept(gen *core.Generation) error {
+	defer m.Chunks.Invalidate(gen.Rect)
+	return gen.Apply(m.Map, m.History)
 }
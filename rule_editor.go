@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/etherealmachine/bento"
+	"github.com/hajimehoshi/ebiten/v2"
+
+	"weave/core"
+)
+
+const (
+	rulesFilename = "rules.json"
+	rulesPerPage  = 8
+	// maxNeighbors is how many neighbors are shown per direction
+	maxNeighbors = 12
+)
+
+// RuleEditor shows the ruleset the map generates from, listing each domain entry with its frequency. The selected
+// entry shows its allowed neighbors in each direction, clicking one removes it, and the target entry can be allowed
+// or forbidden next to it.
+type RuleEditor struct {
+	Map           *Map
+	Open          bool
+	Entry, Target int
+	Page          int
+	// Learn returns the rules the editor would learn from the map to generate with
+	Learn func() (*core.Analysis, error)
+}
+
+func NewRuleEditor(m *Map, learn func() (*core.Analysis, error)) *RuleEditor {
+	return &RuleEditor{Map: m, Learn: learn}
+}
+
+type ruleRow struct {
+	Index       int
+	Name        string
+	Probability float64
+	Selected    bool
+	Target      bool
+}
+
+type ruleDirection struct {
+	Dir       int
+	Name      string
+	Allowed   bool
+	Neighbors []int
+	More      int
+}
+
+func (ui *RuleEditor) entryName(i int) string {
+	if len(ui.Map.Ruleset.Domain[i]) == 0 {
+		return "empty"
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// Rows are the domain entries on the current page
+func (ui *RuleEditor) Rows() []ruleRow {
+	rules := ui.Map.Ruleset
+	if rules == nil {
+		return nil
+	}
+	var rows []ruleRow
+	for i := ui.Page * rulesPerPage; i < len(rules.Domain) && i < (ui.Page+1)*rulesPerPage; i++ {
+		rows = append(rows, ruleRow{
+			Index:       i,
+			Name:        ui.entryName(i),
+			Probability: rules.Probabilities[i],
+			Selected:    i == ui.Entry,
+			Target:      i == ui.Target,
+		})
+	}
+	return rows
+}
+
+// Directions are the neighbors of the selected entry
+func (ui *RuleEditor) Directions() []ruleDirection {
+	rules := ui.Map.Ruleset
+	if rules == nil || ui.Entry >= len(rules.Domain) {
+		return nil
+	}
+	var dirs []ruleDirection
+	for _, d := range rules.Grid.Directions() {
+		ns := rules.Neighbors(ui.Entry, d)
+		dir := ruleDirection{
+			Dir:     int(d),
+			Name:    d.String(),
+			Allowed: ui.Target < len(rules.Domain) && rules.Allowed(ui.Entry, d, ui.Target),
+		}
+		if len(ns) > maxNeighbors {
+			ns, dir.More = ns[:maxNeighbors], len(ns)-maxNeighbors
+		}
+		dir.Neighbors = ns
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func (ui *RuleEditor) Pages() int {
+	if ui.Map.Ruleset == nil {
+		return 0
+	}
+	return (len(ui.Map.Ruleset.Domain) + rulesPerPage - 1) / rulesPerPage
+}
+
+func (ui *RuleEditor) PageName() string {
+	return fmt.Sprintf("page %d of %d", ui.Page+1, ui.Pages())
+}
+
+func (ui *RuleEditor) EntryName() string {
+	return ui.entryName(ui.Entry)
+}
+
+func (ui *RuleEditor) TargetName() string {
+	return ui.entryName(ui.Target)
+}
+
+func (ui *RuleEditor) Toggle(event *bento.Event) {
+	ui.Open = !ui.Open
+}
+
+// LearnRules replaces the ruleset with the rules learned from the map, to be edited
+func (ui *RuleEditor) LearnRules(event *bento.Event) {
+	rules, err := ui.Learn()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	ui.set(rules)
+}
+
+func (ui *RuleEditor) LoadRules(event *bento.Event) {
+	rules, err := core.LoadAnalysis(rulesFilename)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	ui.set(rules)
+}
+
+func (ui *RuleEditor) SaveRules(event *bento.Event) {
+	if err := ui.Map.Ruleset.Save(rulesFilename); err != nil {
+		log.Println(err)
+	}
+}
+
+// ClearRules drops the ruleset, going back to learning from the map whenever it generates
+func (ui *RuleEditor) ClearRules(event *bento.Event) {
+	ui.set(nil)
+}
+
+func (ui *RuleEditor) set(rules *core.Analysis) {
+	ui.Map.Ruleset = rules
+	ui.Entry, ui.Target, ui.Page = 0, 0, 0
+}
+
+func (ui *RuleEditor) PreviousPage(event *bento.Event) {
+	if ui.Page > 0 {
+		ui.Page--
+	}
+}
+
+func (ui *RuleEditor) NextPage(event *bento.Event) {
+	if ui.Page < ui.Pages()-1 {
+		ui.Page++
+	}
+}
+
+func (ui *RuleEditor) SelectEntry(event *bento.Event) {
+	if i, err := strconv.Atoi(event.Box.Attrs["entry"]); err == nil {
+		ui.Entry = i
+	}
+}
+
+func (ui *RuleEditor) SelectTarget(event *bento.Event) {
+	if i, err := strconv.Atoi(event.Box.Attrs["entry"]); err == nil {
+		ui.Target = i
+	}
+}
+
+// ToggleTarget allows or forbids the target entry next to the selected entry in a direction
+func (ui *RuleEditor) ToggleTarget(event *bento.Event) {
+	d, err := strconv.Atoi(event.Box.Attrs["dir"])
+	if err != nil {
+		return
+	}
+	rules := ui.Map.Ruleset
+	rules.Allow(ui.Entry, core.Direction(d), ui.Target, !rules.Allowed(ui.Entry, core.Direction(d), ui.Target))
+}
+
+// RemoveNeighbor forbids a neighbor of the selected entry in a direction
+func (ui *RuleEditor) RemoveNeighbor(event *bento.Event) {
+	d, err := strconv.Atoi(event.Box.Attrs["dir"])
+	if err != nil {
+		return
+	}
+	n, err := strconv.Atoi(event.Box.Attrs["entry"])
+	if err != nil {
+		return
+	}
+	ui.Map.Ruleset.Allow(ui.Entry, core.Direction(d), n, false)
+}
+
+// DrawEntry draws the stack of a domain entry at twice its size
+func (ui *RuleEditor) DrawEntry(event *bento.Event) {
+	i, err := strconv.Atoi(event.Box.Attrs["entry"])
+	if err != nil || ui.Map.Ruleset == nil || i >= len(ui.Map.Ruleset.Domain) {
+		return
+	}
+	w, h := float64(ui.Map.TileWidth), float64(ui.Map.TileHeight)
+	for _, tile := range ui.Map.Ruleset.Domain[i] {
+		img := ui.Map.Image(tile)
+		if img == nil {
+			continue
+		}
+		op := new(ebiten.DrawImageOptions)
+		flipGeoM(op, tile.Flip, w, h)
+		op.GeoM.Scale(2, 2)
+		op.GeoM.Translate(float64(event.Box.X), float64(event.Box.Y))
+		event.Image.DrawImage(img, op)
+	}
+}
+
+func (ui *RuleEditor) TileWidth() int {
+	return 2 * ui.Map.TileWidth
+}
+
+func (ui *RuleEditor) TileHeight() int {
+	return 2 * ui.Map.TileHeight
+}
+
+func (ui *RuleEditor) UI() string {
+	return `<col>
+		<row justify="start center">
+			<button font="RobotoMono 14" btn="ui/button.png 6" color="{{ if .Open }}#ffff00{{ else }}#ffffff{{ end }}" padding="4px" onClick="Toggle">rules</button>
+			{{ if .Open }}
+				<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="LearnRules">learn</button>
+				<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="LoadRules">load</button>
+				{{ if ne .Map.Ruleset nil }}
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="SaveRules">save</button>
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="ClearRules">clear</button>
+				{{ end }}
+			{{ end }}
+		</row>
+		{{ if .Open }}
+			{{ if eq .Map.Ruleset nil }}
+				<text font="RobotoMono 14" color="#ffffff">learning from the map</text>
+			{{ else }}
+				<row justify="start center">
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="PreviousPage">prev</button>
+					<text font="RobotoMono 14" color="#ffffff">{{ .PageName }}</text>
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="NextPage">next</button>
+				</row>
+				{{ range .Rows }}
+					<row justify="start center">
+						<canvas width="{{ $.TileWidth }}" height="{{ $.TileHeight }}" onDraw="DrawEntry" entry="{{ .Index }}" />
+						<button
+								font="RobotoMono 14"
+								btn="ui/button.png 6"
+								color="{{ if .Selected }}#ffff00{{ else }}#ffffff{{ end }}"
+								padding="4px"
+								onClick="SelectEntry"
+								entry="{{ .Index }}"
+						>{{ .Name }} {{ printf "%.3f" .Probability }}</button>
+						<button
+								font="RobotoMono 14"
+								btn="ui/button.png 6"
+								color="{{ if .Target }}#ffff00{{ else }}#ffffff{{ end }}"
+								padding="4px"
+								onClick="SelectTarget"
+								entry="{{ .Index }}"
+						>target</button>
+					</row>
+				{{ end }}
+				<text font="RobotoMono 14" color="#ffffff">neighbors of {{ .EntryName }}</text>
+				{{ range .Directions }}
+					{{ $dir := .Dir }}
+					<row justify="start center">
+						<text font="RobotoMono 14" color="#ffffff">{{ .Name }}</text>
+						<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="ToggleTarget" dir="{{ .Dir }}">{{ if .Allowed }}forbid{{ else }}allow{{ end }} {{ $.TargetName }}</button>
+						{{ range .Neighbors }}
+							<canvas width="{{ $.TileWidth }}" height="{{ $.TileHeight }}" onDraw="DrawEntry" onClick="RemoveNeighbor" entry="{{ . }}" dir="{{ $dir }}" />
+						{{ end }}
+						{{ if gt .More 0 }}
+							<text font="RobotoMono 14" color="#ffffff">+{{ .More }}</text>
+						{{ end }}
+					</row>
+				{{ end }}
+			{{ end }}
+		{{ end }}
+	</col>`
+}
@@ -1,54 +1,323 @@
 package main
 
 import (
-	"strconv"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"sort"
+	"strings"
 
 	"github.com/etherealmachine/bento"
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"weave/core"
 )
 
+// TileSelector shows one spritesheet at a time to pick brushes from. Clicking picks a single tile, dragging
+// picks a rectangle of tiles as a stamp, and shift clicking adds a tile to the random brush. The properties and tags
+// of the selected tile are edited beneath the spritesheet.
 type TileSelector struct {
-	Selected *Tile
-	Tileset  *Tileset
+	*Keyboard
+	Selected  *core.Tile
+	Stamp     *core.Stamp
+	Random    *core.RandomBrush
+	Sheet     string
+	Tileset   *core.Tileset
+	Textures  *Textures
+	drag      *image.Point
+	selection image.Rectangle
+	// drafts are the text typed into the property inputs of draftTile, shown as typed rather than as parsed
+	drafts    map[string]string
+	draftTile core.Tile
 }
 
-func NewTileSelector(tileset *Tileset) *TileSelector {
-	return &TileSelector{Tileset: tileset}
+func NewTileSelector(textures *Textures, keyboard *Keyboard) *TileSelector {
+	ui := &TileSelector{Tileset: textures.Tileset, Textures: textures, Keyboard: keyboard}
+	if names := ui.Sheets(); len(names) > 0 {
+		ui.Sheet = names[0]
+	}
+	return ui
+}
+
+// Clear drops every brush
+func (ui *TileSelector) Clear() {
+	ui.Selected = nil
+	ui.Stamp = nil
+	ui.Random = nil
+}
+
+func (ui *TileSelector) Sheets() []string {
+	var names []string
+	for name := range ui.Tileset.Spritesheets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (ui *TileSelector) Width() int {
+	if img := ui.Textures.Sheet(ui.Sheet); img != nil {
+		return img.Bounds().Dx()
+	}
+	return 0
+}
+
+func (ui *TileSelector) Height() int {
+	if img := ui.Textures.Sheet(ui.Sheet); img != nil {
+		return img.Bounds().Dy()
+	}
+	return 0
 }
 
 func (ui *TileSelector) Draw(event *bento.Event) {
-	i, err := strconv.Atoi(event.Box.Attrs["index"])
-	if err != nil {
+	img := ui.Textures.Sheet(ui.Sheet)
+	if img == nil {
 		return
 	}
-	op := new(ebiten.DrawImageOptions)
-	op.GeoM.Translate(float64(event.Box.X), float64(event.Box.Y))
-	event.Image.DrawImage(ui.Tileset.Tiles()[i].Image, op)
+	sheet := ui.Tileset.Spritesheets[ui.Sheet]
+	if len(sheet.Animations) == 0 {
+		op := new(ebiten.DrawImageOptions)
+		op.GeoM.Translate(float64(event.Box.X), float64(event.Box.Y))
+		event.Image.DrawImage(img, op)
+	} else {
+		// animated tiles play in place, so each tile is drawn on its own
+		now := animationTime()
+		for i := 0; i < sheet.Len(); i++ {
+			frame := ui.Textures.Image(ui.Tileset.Frame(&core.Tile{Spritesheet: ui.Sheet, Index: i}, now))
+			if frame == nil {
+				continue
+			}
+			r := sheet.Rect(i)
+			op := new(ebiten.DrawImageOptions)
+			op.GeoM.Translate(float64(event.Box.X+r.Min.X), float64(event.Box.Y+r.Min.Y))
+			event.Image.DrawImage(frame, op)
+		}
+	}
+	highlight := func(rect image.Rectangle, c color.Color) {
+		ebitenutil.DrawRect(
+			event.Image,
+			float64(event.Box.X+rect.Min.X),
+			float64(event.Box.Y+rect.Min.Y),
+			float64(rect.Dx()),
+			float64(rect.Dy()),
+			c)
+	}
+	for _, tile := range ui.randomTiles() {
+		if tile.Spritesheet == ui.Sheet {
+			highlight(*sheet.Rect(tile.Index), color.RGBA{0, 128, 255, 96})
+		}
+	}
+	if ui.drag != nil || ui.Selected != nil && ui.Selected.Spritesheet == ui.Sheet && ui.Random.Len() == 0 {
+		first := sheet.Rect(ui.selection.Min.Y*sheet.Width + ui.selection.Min.X)
+		last := sheet.Rect((ui.selection.Max.Y-1)*sheet.Width + ui.selection.Max.X - 1)
+		highlight(first.Union(*last), color.RGBA{255, 255, 0, 64})
+	}
 }
 
-func (ui *TileSelector) Click(event *bento.Event) {
+func (ui *TileSelector) randomTiles() []*core.Tile {
+	if ui.Random == nil {
+		return nil
+	}
+	return ui.Random.Tiles
+}
 
+// cell returns the column and row of the tile under x, y
+func (ui *TileSelector) cell(x, y int) image.Point {
+	sheet := ui.Tileset.Spritesheets[ui.Sheet]
+	p := sheet.Cell(x, y)
+	if !p.In(image.Rect(0, 0, sheet.Width, sheet.Height)) {
+		p.X = int(math.Min(math.Max(float64(p.X), 0), float64(sheet.Width-1)))
+		p.Y = int(math.Min(math.Max(float64(p.Y), 0), float64(sheet.Height-1)))
+	}
+	return p
 }
 
 func (ui *TileSelector) Hover(event *bento.Event) {
+	sheet := ui.Tileset.Spritesheets[ui.Sheet]
+	if sheet == nil {
+		return
+	}
+	p := ui.cell(event.X, event.Y)
+	tile := &core.Tile{Spritesheet: ui.Sheet, Index: p.Y*sheet.Width + p.X}
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			if ui.Random == nil {
+				ui.Random = new(core.RandomBrush)
+			}
+			ui.Random.Add(tile, 1)
+			ui.Selected, ui.Stamp = tile, nil
+			return
+		}
+		ui.Random = nil
+		ui.drag = &p
+	}
+	if ui.drag == nil {
+		return
+	}
+	ui.selection = image.Rectangle{Min: *ui.drag, Max: p}.Canon()
+	ui.selection.Max = ui.selection.Max.Add(image.Pt(1, 1))
+	if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		ui.drag = nil
+		ui.Selected = &core.Tile{Spritesheet: ui.Sheet, Index: ui.selection.Min.Y*sheet.Width + ui.selection.Min.X}
+		ui.Stamp = nil
+		if ui.selection.Dx() > 1 || ui.selection.Dy() > 1 {
+			ui.Stamp = sheet.Stamp(ui.selection)
+		}
+	}
+}
+
+func (ui *TileSelector) SelectTileset(event *bento.Event) {
+	ui.Sheet = event.Box.Attrs["sheet"]
+	ui.drag = nil
+}
+
+// Walkable is true unless the selected tile blocks the way in Explore
+func (ui *TileSelector) Walkable() bool {
+	return ui.Tileset.Walkable(ui.Selected)
+}
+
+// ToggleWalkable sets whether the selected tile can be walked over in Explore, saving the spritesheet's properties
+// file
+func (ui *TileSelector) ToggleWalkable(event *bento.Event) {
+	tile := ui.Selected
+	sheet := ui.Tileset.Spritesheets[tile.Spritesheet]
+	sheet.SetWalkable(tile.Index, !ui.Walkable())
+	if err := sheet.SaveProperties(); err != nil {
+		log.Println(err)
+	}
+}
 
+// Tags are the tags of the selected tile, comma separated
+func (ui *TileSelector) Tags() string {
+	return ui.draft("tags", strings.Join(ui.Tileset.Properties(ui.Selected).Tags, ", "))
+}
+
+// SetTags tags the selected tile with the comma separated tags typed, saving the spritesheet's properties file
+func (ui *TileSelector) SetTags(event *bento.Event) {
+	ui.setDraft("tags", event.Value)
+	ui.editProperties(func(p *core.Properties) {
+		p.SetTags(strings.Split(event.Value, ","))
+	})
+}
+
+type propertyRow struct {
+	Key   string
+	Value string
+}
+
+// Properties are the values of the selected tile, one row per key
+func (ui *TileSelector) Properties() []propertyRow {
+	p := ui.Tileset.Properties(ui.Selected)
+	var rows []propertyRow
+	for _, k := range p.Keys() {
+		rows = append(rows, propertyRow{Key: k, Value: ui.draft("value "+k, core.FormatValue(p.Values[k]))})
+	}
+	return rows
+}
+
+// SetProperty sets a value of the selected tile, removing it if it's blank
+func (ui *TileSelector) SetProperty(event *bento.Event) {
+	key := event.Box.Attrs["key"]
+	ui.setDraft("value "+key, event.Value)
+	ui.editProperties(func(p *core.Properties) {
+		p.Set(key, core.ParseValue(event.Value))
+	})
+}
+
+// NewProperty is the key=value typed to add a value to the selected tile
+func (ui *TileSelector) NewProperty() string {
+	return ui.draft("new", "")
+}
+
+// AddProperty sets a value of the selected tile typed as key=value
+func (ui *TileSelector) AddProperty(event *bento.Event) {
+	ui.setDraft("new", event.Value)
+	key, value, ok := strings.Cut(event.Value, "=")
+	if key = strings.TrimSpace(key); !ok || key == "" {
+		return
+	}
+	ui.editProperties(func(p *core.Properties) {
+		p.Set(key, core.ParseValue(value))
+	})
+}
+
+// draft is the text typed into the property input called name, or value if nothing has been since the selected tile
+// changed
+func (ui *TileSelector) draft(name, value string) string {
+	if tile := ui.Selected; tile == nil || *tile != ui.draftTile {
+		return value
+	}
+	if s, ok := ui.drafts[name]; ok {
+		return s
+	}
+	return value
+}
+
+// setDraft keeps the text typed into the property input called name, forgetting those of any other tile
+func (ui *TileSelector) setDraft(name, s string) {
+	tile := ui.Selected
+	if tile == nil {
+		return
+	}
+	if *tile != ui.draftTile || ui.drafts == nil {
+		ui.draftTile = *tile
+		ui.drafts = make(map[string]string)
+	}
+	ui.drafts[name] = s
+}
+
+// editProperties changes the properties of the selected tile with edit, saving the spritesheet's properties file
+func (ui *TileSelector) editProperties(edit func(p *core.Properties)) {
+	tile := ui.Selected
+	if tile == nil {
+		return
+	}
+	sheet := ui.Tileset.Spritesheets[tile.Spritesheet]
+	if sheet == nil {
+		return
+	}
+	edit(sheet.EditProperties(tile.Index))
+	if err := sheet.SaveProperties(); err != nil {
+		log.Println(err)
+	}
 }
 
 func (ui *TileSelector) UI() string {
-	return `<row grow="1">
-		<row grow="1" justify="between" margin="0 0 12px 0">
-			{{ range $index, $img := .Tileset.Tiles }}
-				<canvas width="16" height="16" onDraw="Draw" onClick="Click" onHover="Hover" index="{{ $index }}" />
-			{{ end }}
-			{{ range $name, $sheet := .Tileset.Spritesheets }}
+	return `<col grow="1">
+		<row justify="start center" margin="0 0 12px 0">
+			{{ range .Sheets }}
 				<button
 						font="NotoSans 18"
 						btn="ui/button.png 6"
-						color="#ffffff"
+						color="{{ if eq . $.Sheet }}#ffff00{{ else }}#ffffff{{ end }}"
 						padding="12px"
 						onClick="SelectTileset"
-				>{{ $name }}</button>
+						sheet="{{ . }}"
+				>{{ . }}</button>
 			{{ end }}
 		</row>
-	</row>`
+		<canvas width="{{ .Width }}" height="{{ .Height }}" onDraw="Draw" onHover="Hover" />
+		{{ if ne .Selected nil }}
+			<row justify="start center" margin="12px 0 0 0">
+				<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="ToggleWalkable">{{ if .Walkable }}walkable{{ else }}blocked{{ end }}</button>
+			</row>
+			<row justify="start center">
+				<text font="RobotoMono 14" color="#ffffff">tags</text>
+				<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="192px" onClick="Focus" onChange="SetTags" value="{{ .Tags }}" />
+			</row>
+			{{ range .Properties }}
+				<row justify="start center">
+					<text font="RobotoMono 14" color="#ffffff">{{ .Key }}</text>
+					<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="96px" onClick="Focus" onChange="SetProperty" key="{{ .Key }}" value="{{ .Value }}" />
+				</row>
+			{{ end }}
+			<row justify="start center">
+				<text font="RobotoMono 14" color="#ffffff">key=value</text>
+				<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="192px" onClick="Focus" onChange="AddProperty" value="{{ .NewProperty }}" />
+			</row>
+		{{ end }}
+	</col>`
 }
@@ -1,194 +1,96 @@
 package main
 
 import (
-	"fmt"
-	"image"
-	"log"
-	"path"
-	"strings"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+	"weave/core"
 )
 
-type Tileset struct {
-	Spritesheets map[string]*Spritesheet
-	tiles        []*Tile
+// Textures lazily uploads spritesheets to the GPU the first time one of their tiles is drawn
+type Textures struct {
+	Tileset *core.Tileset
+	sheets  map[string]*ebiten.Image
+	tiles   map[core.Tile]*ebiten.Image
 }
 
-func NewTileset(prefix string) *Tileset {
-	ts := &Tileset{
-		Spritesheets: make(map[string]*Spritesheet),
-	}
-	if err := ts.Add(path.Join(prefix, "dungeon.png"), 16, 1); err != nil {
-		log.Fatal(err)
-	}
-	if err := ts.Add(path.Join(prefix, "general.png"), 16, 1); err != nil {
-		log.Fatal(err)
-	}
-	if err := ts.Add(path.Join(prefix, "indoors.png"), 16, 1); err != nil {
-		log.Fatal(err)
-	}
-	if err := ts.Add(path.Join(prefix, "characters.png"), 16, 1); err != nil {
-		log.Fatal(err)
+func NewTextures(tileset *core.Tileset) *Textures {
+	return &Textures{
+		Tileset: tileset,
+		sheets:  make(map[string]*ebiten.Image),
+		tiles:   make(map[core.Tile]*ebiten.Image),
 	}
-	return ts
 }
 
-func (ts *Tileset) Add(filename string, size, spacing int) error {
-	var err error
-	ts.Spritesheets[filename], err = NewSpritesheet(filename, size, spacing)
-	ts.tiles = nil
-	return err
-}
-
-func (ts *Tileset) Image(t *Tile) *ebiten.Image {
-	if t == nil {
+func (t *Textures) Image(tile *core.Tile) *ebiten.Image {
+	if tile == nil {
 		return nil
 	}
-	if ts.Spritesheets[t.Spritesheet] == nil {
-		return nil
+	if img, ok := t.tiles[*tile]; ok {
+		return img
 	}
-	return ts.Spritesheets[t.Spritesheet].Image(t.Index)
-}
-
-func (ts *Tileset) Tiles() []*Tile {
-	if ts.tiles != nil {
-		return ts.tiles
-	}
-	var tiles []*Tile
-	for name, sheet := range ts.Spritesheets {
-		for i, img := range sheet.Tiles() {
-			tiles = append(tiles, &Tile{
-				Spritesheet: name,
-				Index:       i,
-				Image:       img,
-			})
-		}
-	}
-	ts.tiles = tiles
-	return tiles
-}
-
-type Spritesheet struct {
-	Name          string
-	Img           *ebiten.Image
-	Size          int
-	Spacing       int
-	Width, Height int
-	tiles         []*ebiten.Image
-}
-
-func NewSpritesheet(filename string, size, spacing int) (*Spritesheet, error) {
-	img, _, err := ebitenutil.NewImageFromFile(filename)
-	if err != nil {
-		return nil, err
-	}
-	w := size + spacing
-	bounds := img.Bounds()
-	width, height := (bounds.Dx()/w)+1, (bounds.Dy()/w)+1
-	return &Spritesheet{
-		Name:    filename,
-		Img:     img,
-		Size:    size,
-		Spacing: spacing,
-		Width:   width,
-		Height:  height,
-		tiles:   make([]*ebiten.Image, width*height),
-	}, nil
-}
-
-func (s *Spritesheet) Image(index int) *ebiten.Image {
-	if s == nil || index < 0 || index >= len(s.tiles) {
+	sheet := t.Tileset.Spritesheets[tile.Spritesheet]
+	if sheet == nil || tile.Index < 0 || tile.Index >= sheet.Len() {
 		return nil
 	}
-	if s.tiles[index] == nil {
-		rect := s.Rect(index)
-		s.tiles[index] = ebiten.NewImageFromImage(s.Img.SubImage(*rect))
+	sheetImg := t.Sheet(tile.Spritesheet)
+	if sheetImg == nil {
+		return nil
 	}
-	return s.tiles[index]
+	img := sheetImg.SubImage(*sheet.Rect(tile.Index)).(*ebiten.Image)
+	t.tiles[*tile] = img
+	return img
 }
 
-func (s *Spritesheet) TileAt(x, y int) int {
-	if s == nil {
-		return 0
+// Sheet returns the texture of an entire spritesheet, or nil if it isn't loaded
+func (t *Textures) Sheet(name string) *ebiten.Image {
+	if img, ok := t.sheets[name]; ok {
+		return img
 	}
-	w := s.Size + s.Spacing
-	return (y/w)*s.Width + (x / w) + 1
-}
-
-func (s *Spritesheet) Rect(index int) *image.Rectangle {
-	if s == nil || index < 0 {
+	sheet := t.Tileset.Spritesheets[name]
+	if sheet == nil || sheet.Image == nil {
 		return nil
 	}
-	w := s.Size + s.Spacing
-	x := (index % s.Width) * w
-	y := (index / s.Width) * w
-	rect := image.Rect(x, y, x+s.Size, y+s.Size)
-	return &rect
+	img := ebiten.NewImageFromImage(sheet.Image)
+	t.sheets[name] = img
+	return img
 }
 
-func (s *Spritesheet) Tiles() []*ebiten.Image {
-	for i, img := range s.tiles {
-		if img == nil {
-			s.tiles[i] = s.Image(i)
-		}
+// Forget drops the textures of the named spritesheet, e.g. after it's removed or replaced
+func (t *Textures) Forget(name string) {
+	if img := t.sheets[name]; img != nil {
+		img.Dispose()
+		delete(t.sheets, name)
 	}
-	return s.tiles
-}
-
-type Tile struct {
-	Spritesheet string
-	Index       int
-	Image       *ebiten.Image
-}
-
-func (t *Tile) Hash() string {
-	return fmt.Sprintf("%s:%d", t.Spritesheet, t.Index)
-}
-
-type Stack []*Tile
-
-func (s Stack) Hash() string {
-	a := make([]string, len(s))
-	for i, t := range s {
-		a[i] = t.Hash()
+	for tile := range t.tiles {
+		if tile.Spritesheet == name {
+			delete(t.tiles, tile)
+		}
 	}
-	return strings.Join(a, ",")
 }
 
-type Tilemap map[int]map[int]Stack
-
-func (m Tilemap) Set(tile *Tile, x, y int, replace bool, z int) {
-	if m[x] == nil {
-		m[x] = make(map[int]Stack)
-	}
-	l := len(m[x][y])
-	if l == 0 {
-		// first tile in the stack
-		m[x][y] = Stack{tile}
-	} else if z >= l {
-		// append
-		m[x][y] = append(m[x][y], tile)
-	} else if replace {
-		// replace
-		m[x][y][z] = tile
-	} else {
-		// insert
-		m[x][y] = append(m[x][y][:z+1], m[x][y][z:]...)
-		m[x][y][z] = tile
-	}
+// animationTime is how far into their animations animated tiles are, in milliseconds, the same for every tile so they
+// play in step
+func animationTime() int64 {
+	return time.Now().UnixMilli()
 }
 
-func (m Tilemap) At(x, y, z int) *Tile {
-	if len(m[x]) == 0 {
-		return nil
+// flipGeoM starts op with the transform that draws a w x h tile flipped in place, matching core.Flip.Transform
+func flipGeoM(op *ebiten.DrawImageOptions, f core.Flip, w, h float64) {
+	if f&core.FlipDiagonal != 0 {
+		op.GeoM.SetElement(0, 0, 0)
+		op.GeoM.SetElement(0, 1, 1)
+		op.GeoM.SetElement(1, 0, 1)
+		op.GeoM.SetElement(1, 1, 0)
+		w, h = h, w
 	}
-	if len(m[x][y]) == 0 {
-		return nil
+	if f&core.FlipHorizontal != 0 {
+		op.GeoM.Scale(-1, 1)
+		op.GeoM.Translate(w, 0)
 	}
-	if z < 0 || z >= len(m[x][y]) {
-		return nil
+	if f&core.FlipVertical != 0 {
+		op.GeoM.Scale(1, -1)
+		op.GeoM.Translate(0, h)
 	}
-	return m[x][y][z]
 }
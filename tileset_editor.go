@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/etherealmachine/bento"
+
+	"weave/core"
+)
+
+// manifestFilename is the tileset manifest the editor starts with, see core.LoadManifest
+const manifestFilename = "tileset.json"
+
+// TilesetEditor adds spritesheets to the map's tileset and removes them, saving its manifest. A spritesheet is
+// added from its image file and the geometry of its tiles, with the columns and rows fit to the image.
+type TilesetEditor struct {
+	*Keyboard
+	Map          *Map
+	TileSelector *TileSelector
+	Open         bool
+	// Fields are the spritesheet to add as typed, by name
+	Fields map[string]string
+	Err    error
+}
+
+func NewTilesetEditor(m *Map, selector *TileSelector) *TilesetEditor {
+	return &TilesetEditor{Keyboard: selector.Keyboard, Map: m, TileSelector: selector, Fields: map[string]string{
+		"path":    "",
+		"width":   strconv.Itoa(m.TileWidth),
+		"height":  strconv.Itoa(m.TileHeight),
+		"spacing": "0",
+		"margin":  "0",
+		"offsetX": "0",
+		"offsetY": "0",
+	}}
+}
+
+type sheetRow struct {
+	Name string
+	Size string
+}
+
+// Sheets lists the spritesheets of the tileset, by name
+func (ui *TilesetEditor) Sheets() []sheetRow {
+	var rows []sheetRow
+	for name, sheet := range ui.Map.Spritesheets {
+		rows = append(rows, sheetRow{
+			Name: name,
+			Size: fmt.Sprintf("%dx%d tiles of %dx%d", sheet.Width, sheet.Height, sheet.TileWidth, sheet.TileHeight),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Name < rows[j].Name
+	})
+	return rows
+}
+
+func (ui *TilesetEditor) Toggle(event *bento.Event) {
+	ui.Open = !ui.Open
+}
+
+// SetField keeps what was typed into one of the fields of the spritesheet to add
+func (ui *TilesetEditor) SetField(event *bento.Event) {
+	ui.Fields[event.Box.Attrs["field"]] = event.Value
+}
+
+// AddSheet loads the spritesheet described by the fields into the tileset
+func (ui *TilesetEditor) AddSheet(event *bento.Event) {
+	sheet, err := ui.sheet()
+	if err == nil {
+		err = ui.Map.Tileset.Add(sheet)
+	}
+	if ui.Err = err; err != nil {
+		return
+	}
+	ui.Map.Textures.Forget(sheet.Name)
+	ui.Map.Chunks.Reset()
+	ui.TileSelector.Sheet = sheet.Name
+	ui.TileSelector.Clear()
+	ui.Fields["path"] = ""
+	ui.save()
+}
+
+// sheet is the spritesheet described by the fields, its height being its width unless given
+func (ui *TilesetEditor) sheet() (*core.Spritesheet, error) {
+	path := strings.TrimSpace(ui.Fields["path"])
+	if path == "" {
+		return nil, fmt.Errorf("no image to add")
+	}
+	n := make(map[string]int)
+	for _, field := range []string{"width", "height", "spacing", "margin", "offsetX", "offsetY"} {
+		s := strings.TrimSpace(ui.Fields[field])
+		if s == "" {
+			continue
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q isn't a number", field, s)
+		}
+		n[field] = v
+	}
+	if n["height"] == 0 {
+		n["height"] = n["width"]
+	}
+	return &core.Spritesheet{
+		Name:       path,
+		TileWidth:  n["width"],
+		TileHeight: n["height"],
+		Spacing:    n["spacing"],
+		Margin:     n["margin"],
+		OffsetX:    n["offsetX"],
+		OffsetY:    n["offsetY"],
+	}, nil
+}
+
+// RemoveSheet drops a spritesheet from the tileset, along with every tile of the map drawn from it
+func (ui *TilesetEditor) RemoveSheet(event *bento.Event) {
+	name := event.Box.Attrs["sheet"]
+	ui.Map.Tileset.Remove(name)
+	ui.Map.Textures.Forget(name)
+	ui.Map.Chunks.Reset()
+	if ui.TileSelector.Sheet == name {
+		ui.TileSelector.Sheet = ""
+		if names := ui.TileSelector.Sheets(); len(names) > 0 {
+			ui.TileSelector.Sheet = names[0]
+		}
+	}
+	ui.TileSelector.Clear()
+	ui.save()
+}
+
+// save writes the manifest, and the map without the tiles of any spritesheet that was removed
+func (ui *TilesetEditor) save() {
+	if err := ui.Map.SaveManifest(); err != nil {
+		log.Println(err)
+	}
+	if err := ui.Map.Save("map.json"); err != nil {
+		log.Println(err)
+	}
+}
+
+func (ui *TilesetEditor) UI() string {
+	return `<col>
+		<row justify="start center">
+			<button font="RobotoMono 14" btn="ui/button.png 6" color="{{ if .Open }}#ffff00{{ else }}#ffffff{{ end }}" padding="4px" onClick="Toggle">tilesets</button>
+		</row>
+		{{ if .Open }}
+			{{ range .Sheets }}
+				<row justify="start center">
+					<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="RemoveSheet" sheet="{{ .Name }}">remove</button>
+					<text font="RobotoMono 14" color="#ffffff">{{ .Name }} {{ .Size }}</text>
+				</row>
+			{{ end }}
+			<row justify="start center">
+				<text font="RobotoMono 14" color="#ffffff">image</text>
+				<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="256px" onClick="Focus" onChange="SetField" field="path" value="{{ .Fields.path }}" />
+			</row>
+			<row justify="start center">
+				<text font="RobotoMono 14" color="#ffffff">tile</text>
+				<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="48px" onClick="Focus" onChange="SetField" field="width" value="{{ .Fields.width }}" />
+				<text font="RobotoMono 14" color="#ffffff">x</text>
+				<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="48px" onClick="Focus" onChange="SetField" field="height" value="{{ .Fields.height }}" />
+				<text font="RobotoMono 14" color="#ffffff">spacing</text>
+				<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="48px" onClick="Focus" onChange="SetField" field="spacing" value="{{ .Fields.spacing }}" />
+				<text font="RobotoMono 14" color="#ffffff">margin</text>
+				<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="48px" onClick="Focus" onChange="SetField" field="margin" value="{{ .Fields.margin }}" />
+			</row>
+			<row justify="start center">
+				<text font="RobotoMono 14" color="#ffffff">offset</text>
+				<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="48px" onClick="Focus" onChange="SetField" field="offsetX" value="{{ .Fields.offsetX }}" />
+				<input font="RobotoMono 14" input="ui/button.png 6" color="#ffffff" padding="4px" minWidth="48px" onClick="Focus" onChange="SetField" field="offsetY" value="{{ .Fields.offsetY }}" />
+				<button font="RobotoMono 14" btn="ui/button.png 6" color="#ffffff" padding="4px" onClick="AddSheet">add</button>
+			</row>
+			{{ if .Err }}
+				<text font="RobotoMono 14" color="#ff0000">{{ .Err }}</text>
+			{{ end }}
+		{{ end }}
+	</col>`
+}